@@ -0,0 +1,102 @@
+package bitfield
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZeroAllocDecode(t *testing.T) {
+	bf := NewFromSet(getRandIndexSet(10000))
+	bf, err := bf.Copy()
+	require.NoError(t, err)
+
+	expected, err := bf.Count()
+	require.NoError(t, err)
+	first, err := bf.First()
+	require.NoError(t, err)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		c, err := bf.Count()
+		if err != nil || c != expected {
+			t.Fatal("bad count", c, err)
+		}
+	})
+	assert.Zero(t, allocs, "Count")
+
+	allocs = testing.AllocsPerRun(100, func() {
+		f, err := bf.First()
+		if err != nil || f != first {
+			t.Fatal("bad first", f, err)
+		}
+	})
+	assert.Zero(t, allocs, "First")
+
+	allocs = testing.AllocsPerRun(100, func() {
+		set, err := bf.IsSet(first)
+		if err != nil || !set {
+			t.Fatal("bad IsSet", set, err)
+		}
+	})
+	assert.Zero(t, allocs, "IsSet")
+
+	// IsSet doesn't allocate for modified bitfields either.
+	bf.Set(1 << 40)
+	bf.Unset(first)
+	allocs = testing.AllocsPerRun(100, func() {
+		set, err := bf.IsSet(first + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = set
+	})
+	assert.Zero(t, allocs, "IsSet modified")
+}
+
+func TestPooledDecodeMatches(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		set := getRandIndexSetSeed(1000, int64(i))
+		bf := NewFromSet(set)
+		copied, err := bf.Copy()
+		require.NoError(t, err)
+
+		// The pooled path is only taken for unmodified bitfields.
+		c1, err := bf.Count()
+		require.NoError(t, err)
+		c2, err := copied.Count()
+		require.NoError(t, err)
+		assert.Equal(t, c1, c2)
+
+		f1, err := bf.First()
+		require.NoError(t, err)
+		f2, err := copied.First()
+		require.NoError(t, err)
+		assert.Equal(t, f1, f2)
+
+		for _, b := range set[:10] {
+			isSet, err := copied.IsSet(b)
+			require.NoError(t, err)
+			assert.True(t, isSet)
+			isSet, err = copied.IsSet(b + 1<<30)
+			require.NoError(t, err)
+			assert.False(t, isSet)
+		}
+	}
+
+	_, err := New().First()
+	assert.Equal(t, ErrNoBitsSet, err)
+}
+
+func BenchmarkPooledCount(b *testing.B) {
+	bf := NewFromSet(getRandIndexSet(10000))
+	bf, err := bf.Copy()
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := bf.Count(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package bitfield
+
+import (
+	"math"
+
+	"golang.org/x/xerrors"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+)
+
+// NextSet returns the first set bit at or after from, or ErrNoBitsSet if there
+// isn't one.
+//
+// This operation's runtime is O(number of runs).
+func (bf BitField) NextSet(from uint64) (uint64, error) {
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return 0, err
+	}
+
+	var pos uint64
+	for iter.HasNext() {
+		r, err := iter.NextRun()
+		if err != nil {
+			return 0, err
+		}
+		end := pos + r.Len
+		if r.Val && end > from {
+			return max(pos, from), nil
+		}
+		pos = end
+	}
+	return 0, ErrNoBitsSet
+}
+
+// NextUnset returns the first unset bit at or after from.
+//
+// This operation's runtime is O(number of runs).
+func (bf BitField) NextUnset(from uint64) (uint64, error) {
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return 0, err
+	}
+
+	var pos uint64
+	for iter.HasNext() {
+		r, err := iter.NextRun()
+		if err != nil {
+			return 0, err
+		}
+		end := pos + r.Len
+		if !r.Val && end > from {
+			return max(pos, from), nil
+		}
+		pos = end
+	}
+	// All bits after the last run are unset.
+	return max(pos, from), nil
+}
+
+// FindFreeRange returns the first bit at or after from that starts a range of
+// at least length unset bits.
+//
+// This operation's runtime is O(number of runs).
+func (bf BitField) FindFreeRange(length, from uint64) (uint64, error) {
+	if length == 0 {
+		return 0, xerrors.New("cannot find a free range of length 0")
+	}
+
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return 0, err
+	}
+
+	var pos uint64
+	for iter.HasNext() {
+		r, err := iter.NextRun()
+		if err != nil {
+			return 0, err
+		}
+		end := pos + r.Len
+		if !r.Val && end > from {
+			if start := max(pos, from); end-start >= length {
+				return start, nil
+			}
+		}
+		pos = end
+	}
+
+	start := max(pos, from)
+	if math.MaxUint64-start < length {
+		return 0, xerrors.Errorf("no free range of length %d after bit %d", length, from)
+	}
+	return start, nil
+}
+
+// AllocateN allocates the n lowest unset bits. It returns a bitfield with the
+// allocated bits, and the updated bitfield with the allocated bits set. The
+// original bitfield isn't modified.
+//
+// This operation's runtime is O(number of runs).
+func (bf BitField) AllocateN(n uint64) (allocated, updated BitField, err error) {
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return BitField{}, BitField{}, err
+	}
+
+	var (
+		runs []rlepluslazy.Run
+		pos  uint64 // position of the current run
+		end  uint64 // end of the last allocated run
+		left = n
+	)
+	for iter.HasNext() && left > 0 {
+		r, err := iter.NextRun()
+		if err != nil {
+			return BitField{}, BitField{}, err
+		}
+		if !r.Val {
+			l := min(r.Len, left)
+			runs = appendAllocated(runs, pos-end, l)
+			end = pos + l
+			left -= l
+		}
+		pos += r.Len
+	}
+	if left > 0 {
+		if math.MaxUint64-pos < left {
+			return BitField{}, BitField{}, xerrors.Errorf("cannot allocate %d bits: %w", n, ErrBitFieldTooMany)
+		}
+		runs = appendAllocated(runs, pos-end, left)
+	}
+
+	allocated, err = NewFromIter(&rlepluslazy.RunSliceIterator{Runs: runs})
+	if err != nil {
+		return BitField{}, BitField{}, err
+	}
+	updated, err = MergeBitFields(bf, allocated)
+	if err != nil {
+		return BitField{}, BitField{}, err
+	}
+	return allocated, updated, nil
+}
+
+// appendAllocated appends a run of length allocated bits, gap bits after the
+// previous run.
+func appendAllocated(runs []rlepluslazy.Run, gap, length uint64) []rlepluslazy.Run {
+	if gap > 0 {
+		runs = append(runs, rlepluslazy.Run{Val: false, Len: gap})
+	}
+	return append(runs, rlepluslazy.Run{Val: true, Len: length})
+}
@@ -0,0 +1,143 @@
+package bitfield
+
+import (
+	"math"
+	"testing"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextSetUnset(t *testing.T) {
+	bf := NewFromSet([]uint64{0, 1, 2, 5, 6, 10})
+
+	for _, tc := range []struct {
+		from, set, unset uint64
+	}{
+		{0, 0, 3},
+		{2, 2, 3},
+		{3, 5, 3},
+		{5, 5, 7},
+		{7, 10, 7},
+		{10, 10, 11},
+	} {
+		set, err := bf.NextSet(tc.from)
+		require.NoError(t, err)
+		assert.Equal(t, tc.set, set, "NextSet(%d)", tc.from)
+
+		unset, err := bf.NextUnset(tc.from)
+		require.NoError(t, err)
+		assert.Equal(t, tc.unset, unset, "NextUnset(%d)", tc.from)
+	}
+
+	_, err := bf.NextSet(11)
+	assert.Equal(t, ErrNoBitsSet, err)
+	unset, err := bf.NextUnset(1000)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1000, unset)
+
+	_, err = New().NextSet(0)
+	assert.Equal(t, ErrNoBitsSet, err)
+	unset, err = New().NextUnset(0)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, unset)
+}
+
+func TestFindFreeRange(t *testing.T) {
+	bf := NewFromSet([]uint64{0, 1, 2, 5, 6, 10, 11, 12, 13, 20})
+
+	for _, tc := range []struct {
+		length, from, start uint64
+	}{
+		{1, 0, 3},
+		{2, 0, 3},
+		{3, 0, 7},
+		{3, 8, 14},
+		{6, 0, 14},
+		{7, 0, 21},
+		{1, 4, 4},
+		{2, 4, 7},
+		{100, 50, 50},
+	} {
+		start, err := bf.FindFreeRange(tc.length, tc.from)
+		require.NoError(t, err)
+		assert.Equal(t, tc.start, start, "FindFreeRange(%d, %d)", tc.length, tc.from)
+	}
+
+	_, err := bf.FindFreeRange(0, 0)
+	assert.Error(t, err)
+	_, err = bf.FindFreeRange(math.MaxUint64, 0)
+	assert.Error(t, err)
+}
+
+func TestAllocateN(t *testing.T) {
+	bf := NewFromSet([]uint64{0, 1, 2, 5, 6, 10})
+
+	allocated, updated, err := bf.AllocateN(5)
+	require.NoError(t, err)
+
+	bits, err := allocated.All(100)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{3, 4, 7, 8, 9}, bits)
+
+	bits, err = updated.All(100)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, bits)
+
+	// The original is unchanged.
+	count, err := bf.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 6, count)
+
+	allocated, updated, err = updated.AllocateN(3)
+	require.NoError(t, err)
+	bits, err = allocated.All(100)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{11, 12, 13}, bits)
+	last, err := updated.Last()
+	require.NoError(t, err)
+	assert.EqualValues(t, 13, last)
+
+	allocated, _, err = New().AllocateN(0)
+	require.NoError(t, err)
+	empty, err := allocated.IsEmpty()
+	require.NoError(t, err)
+	assert.True(t, empty)
+
+	full, err := NewFromIter(&rlepluslazy.RunSliceIterator{Runs: []rlepluslazy.Run{
+		{Val: true, Len: math.MaxUint64 - 2},
+	}})
+	require.NoError(t, err)
+	_, _, err = full.AllocateN(3)
+	assert.Error(t, err)
+}
+
+func TestAllocateNRandom(t *testing.T) {
+	for i := int64(0); i < 20; i++ {
+		set := getRandIndexSetSeed(1000, i)
+		bf := NewFromSet(set)
+		isSet := make(map[uint64]bool)
+		for _, b := range set {
+			isSet[b] = true
+		}
+
+		var expected []uint64
+		for b := uint64(0); len(expected) < 500; b++ {
+			if !isSet[b] {
+				expected = append(expected, b)
+			}
+		}
+
+		allocated, updated, err := bf.AllocateN(500)
+		require.NoError(t, err)
+		bits, err := allocated.All(1000)
+		require.NoError(t, err)
+		assert.Equal(t, expected, bits)
+
+		count, err := updated.Count()
+		require.NoError(t, err)
+		assert.EqualValues(t, len(set)+500, count)
+	}
+}
@@ -0,0 +1,176 @@
+package bitfield
+
+import (
+	"math"
+	"sort"
+
+	"golang.org/x/xerrors"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+)
+
+// AllocationPolicy chooses which unset bits of a bitfield to allocate.
+type AllocationPolicy interface {
+	// Select returns n bits that are unset in used.
+	Select(used BitField, n uint64) (BitField, error)
+}
+
+// Allocator allocates bits from a bitfield of used bits, such as sector
+// numbers, choosing them with an AllocationPolicy.
+//
+// Allocators are not safe for concurrent use.
+type Allocator struct {
+	used   BitField
+	policy AllocationPolicy
+}
+
+// NewAllocator returns an Allocator for the bits that aren't set in used.
+func NewAllocator(used BitField, policy AllocationPolicy) *Allocator {
+	return &Allocator{used: used, policy: policy}
+}
+
+// Used returns the bitfield of used bits.
+func (a *Allocator) Used() BitField {
+	return a.used
+}
+
+// Allocate allocates n bits, marking them as used, and returns them.
+func (a *Allocator) Allocate(n uint64) (BitField, error) {
+	allocated, err := a.policy.Select(a.used, n)
+	if err != nil {
+		return BitField{}, err
+	}
+	used, err := MergeBitFields(a.used, allocated)
+	if err != nil {
+		return BitField{}, err
+	}
+	a.used = used
+	return allocated, nil
+}
+
+// Free marks the bits as unused.
+func (a *Allocator) Free(bits BitField) error {
+	used, err := SubtractBitField(a.used, bits)
+	if err != nil {
+		return err
+	}
+	a.used = used
+	return nil
+}
+
+// FirstFit allocates the lowest unset bits.
+type FirstFit struct{}
+
+func (FirstFit) Select(used BitField, n uint64) (BitField, error) {
+	allocated, _, err := used.AllocateN(n)
+	return allocated, err
+}
+
+// AppendOnly allocates the bits following the last set bit, never filling
+// gaps.
+type AppendOnly struct{}
+
+func (AppendOnly) Select(used BitField, n uint64) (BitField, error) {
+	start, err := used.Last()
+	switch err {
+	case nil:
+		start++
+	case ErrNoBitsSet:
+	default:
+		return BitField{}, err
+	}
+
+	if math.MaxUint64-start < n {
+		return BitField{}, xerrors.Errorf("cannot allocate %d bits: %w", n, ErrBitFieldTooMany)
+	}
+	return allocatedRanges([]bitRange{{start: start, length: n}})
+}
+
+// BestFit allocates bits to keep the number of runs low. If a gap between set
+// bits can fit all the bits, the smallest such gap is used. Otherwise, the
+// smallest gaps are filled completely, as each filled gap joins two runs.
+// The gap after the last set bit is only used if no other gap is large enough.
+type BestFit struct{}
+
+func (BestFit) Select(used BitField, n uint64) (BitField, error) {
+	iter, err := used.RunIterator()
+	if err != nil {
+		return BitField{}, err
+	}
+
+	var (
+		gaps []bitRange
+		pos  uint64
+	)
+	for iter.HasNext() {
+		r, err := iter.NextRun()
+		if err != nil {
+			return BitField{}, err
+		}
+		if !r.Val {
+			gaps = append(gaps, bitRange{start: pos, length: r.Len})
+		}
+		pos += r.Len
+	}
+	// Iterators don't return a trailing run of zeros, so this is the gap
+	// after the last set bit.
+	tail := bitRange{start: pos, length: math.MaxUint64 - pos}
+
+	sort.SliceStable(gaps, func(i, j int) bool {
+		return gaps[i].length < gaps[j].length
+	})
+
+	var allocated []bitRange
+	left := n
+	for left > 0 {
+		// Gaps are sorted by length, so this is the smallest gap that fits.
+		i := sort.Search(len(gaps), func(i int) bool {
+			return gaps[i].length >= left
+		})
+		switch {
+		case i < len(gaps):
+			allocated = append(allocated, bitRange{start: gaps[i].start, length: left})
+			left = 0
+		case len(gaps) > 0:
+			allocated = append(allocated, gaps[0])
+			left -= gaps[0].length
+			gaps = gaps[1:]
+		case tail.length >= left:
+			allocated = append(allocated, bitRange{start: tail.start, length: left})
+			left = 0
+		default:
+			return BitField{}, xerrors.Errorf("cannot allocate %d bits: %w", n, ErrBitFieldTooMany)
+		}
+	}
+
+	sort.Slice(allocated, func(i, j int) bool {
+		return allocated[i].start < allocated[j].start
+	})
+	return allocatedRanges(allocated)
+}
+
+type bitRange struct {
+	start, length uint64
+}
+
+// allocatedRanges returns a bitfield with the bits in the sorted,
+// non-overlapping ranges set.
+func allocatedRanges(ranges []bitRange) (BitField, error) {
+	var (
+		runs []rlepluslazy.Run
+		end  uint64
+	)
+	for _, r := range ranges {
+		if r.length == 0 {
+			continue
+		}
+		if len(runs) > 0 && r.start == end {
+			runs[len(runs)-1].Len += r.length
+			end += r.length
+			continue
+		}
+		runs = appendAllocated(runs, r.start-end, r.length)
+		end = r.start + r.length
+	}
+	return NewFromIter(&rlepluslazy.RunSliceIterator{Runs: runs})
+}
@@ -0,0 +1,102 @@
+package bitfield
+
+import (
+	"math/rand"
+	"testing"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocationPolicies(t *testing.T) {
+	// Gaps of 2 at 3, 4 at 7, 1 at 15, and 3 at 20.
+	used := NewFromSet([]uint64{0, 1, 2, 5, 6, 11, 12, 13, 14, 16, 17, 18, 19, 23})
+
+	for _, tc := range []struct {
+		name     string
+		policy   AllocationPolicy
+		n        uint64
+		expected []uint64
+	}{
+		{"first-fit", FirstFit{}, 3, []uint64{3, 4, 7}},
+		{"append-only", AppendOnly{}, 3, []uint64{24, 25, 26}},
+		{"best-fit/exact", BestFit{}, 3, []uint64{20, 21, 22}},
+		{"best-fit/smallest", BestFit{}, 1, []uint64{15}},
+		{"best-fit/partial", BestFit{}, 4, []uint64{7, 8, 9, 10}},
+		{"best-fit/fill", BestFit{}, 6, []uint64{3, 4, 15, 20, 21, 22}},
+		{"best-fit/tail", BestFit{}, 12, []uint64{3, 4, 7, 8, 9, 10, 15, 20, 21, 22, 24, 25}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := NewAllocator(used, tc.policy)
+			allocated, err := a.Allocate(tc.n)
+			require.NoError(t, err)
+			bits, err := allocated.All(100)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, bits)
+
+			// The allocated bits are now used.
+			both, err := IntersectBitField(allocated, a.Used())
+			require.NoError(t, err)
+			count, err := both.Count()
+			require.NoError(t, err)
+			assert.Equal(t, tc.n, count)
+
+			require.NoError(t, a.Free(allocated))
+			assert.Equal(t, marshalBytes(t, used), marshalBytes(t, a.Used()))
+		})
+	}
+
+	for _, policy := range []AllocationPolicy{FirstFit{}, BestFit{}, AppendOnly{}} {
+		allocated, err := NewAllocator(New(), policy).Allocate(2)
+		require.NoError(t, err)
+		bits, err := allocated.All(10)
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{0, 1}, bits)
+	}
+}
+
+// TestAllocationSimulation simulates allocating and freeing sector numbers
+// under each policy, starting from a fragmented bitfield, and reports the
+// growth of the encoded size. Run with -v to see the report.
+func TestAllocationSimulation(t *testing.T) {
+	const steps = 300
+
+	for _, tc := range []struct {
+		name   string
+		policy AllocationPolicy
+	}{
+		{"first-fit", FirstFit{}},
+		{"best-fit", BestFit{}},
+		{"append-only", AppendOnly{}},
+	} {
+		used, err := NewFromIter(rlepluslazy.NewFromZipfDist(42, 2000))
+		require.NoError(t, err)
+		initial, err := used.EncodedSize()
+		require.NoError(t, err)
+
+		a := NewAllocator(used, tc.policy)
+		r := rand.New(rand.NewSource(7))
+		for i := 0; i < steps; i++ {
+			// Free a few random sectors.
+			last, err := a.Used().Last()
+			require.NoError(t, err)
+			var freed []uint64
+			for j := 0; j < 3; j++ {
+				b, err := a.Used().NextSet(uint64(r.Int63n(int64(last))))
+				require.NoError(t, err)
+				freed = append(freed, b)
+			}
+			require.NoError(t, a.Free(NewFromSet(freed)))
+
+			_, err = a.Allocate(uint64(1 + r.Intn(8)))
+			require.NoError(t, err)
+		}
+
+		st, err := a.Used().Stats()
+		require.NoError(t, err)
+		t.Logf("%-12s size: %5d -> %5d bytes, runs: %5d, last: %d",
+			tc.name, initial, st.EncodedSize, st.Runs, st.Last)
+	}
+}
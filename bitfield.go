@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
 
 	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
 	cbg "github.com/whyrusleeping/cbor-gen"
@@ -11,8 +12,9 @@ import (
 )
 
 var (
-	ErrBitFieldTooMany = errors.New("to many items in RLE")
-	ErrNoBitsSet       = errors.New("bitfield has no set bits")
+	ErrBitFieldTooMany  = errors.New("to many items in RLE")
+	ErrNoBitsSet        = errors.New("bitfield has no set bits")
+	ErrBitFieldTooLarge = errors.New("encoded bitfield was too large")
 )
 
 // MaxEncodedSize is the maximum encoded size of a bitfield. When expanded into
@@ -21,6 +23,15 @@ var (
 // This bitfield can fit at least 3072 sparse elements.
 const MaxEncodedSize = 32 << 10
 
+// checkEncodedSize checks the size of an encoded bitfield against
+// MaxEncodedSize. All encodings use it, so they accept the same bitfields.
+func checkEncodedSize(n uint64) error {
+	if n > MaxEncodedSize {
+		return xerrors.Errorf("%w (%d)", ErrBitFieldTooLarge, n)
+	}
+	return nil
+}
+
 type BitField struct {
 	rle rlepluslazy.RLE
 
@@ -86,6 +97,14 @@ func NewFromIter(r rlepluslazy.RunIterator) (BitField, error) {
 	return newWithRle(rle), nil
 }
 
+// NewFromWords constructs a BitField from a dense bitmap, where bit i is stored
+// in bit i%64 of words[i/64].
+//
+// This operation's runtime is O(number of runs + number of words).
+func NewFromWords(words []uint64) (BitField, error) {
+	return NewFromIter(rlepluslazy.RunsFromWords(words))
+}
+
 // MergeBitFields returns the union of the two BitFields.
 //
 // For example, given two BitFields:
@@ -245,36 +264,54 @@ func CutBitField(a, b BitField) (BitField, error) {
 }
 
 func (bf BitField) RunIterator() (rlepluslazy.RunIterator, error) {
+	set, unset := bf.sortedChanges()
+	return bf.runIteratorWith(set, unset)
+}
+
+// sortedChanges returns the bits explicitly set and unset, sorted.
+func (bf BitField) sortedChanges() (set, unset []uint64) {
+	if len(bf.set) > 0 {
+		set = make([]uint64, 0, len(bf.set))
+		for b := range bf.set {
+			set = append(set, b)
+		}
+		slices.Sort(set)
+	}
+	if len(bf.unset) > 0 {
+		unset = make([]uint64, 0, len(bf.unset))
+		for b := range bf.unset {
+			unset = append(unset, b)
+		}
+		slices.Sort(unset)
+	}
+	return set, unset
+}
+
+// runIteratorWith returns an iterator over the runs of the bitfield, given the
+// result of sortedChanges. The slices aren't modified, so they can be reused to
+// iterate again.
+func (bf BitField) runIteratorWith(set, unset []uint64) (rlepluslazy.RunIterator, error) {
 	iter, err := bf.rle.RunIterator()
 	if err != nil {
 		return nil, err
 	}
-	if len(bf.set) > 0 {
-		slc := make([]uint64, 0, len(bf.set))
-		for b := range bf.set {
-			slc = append(slc, b)
-		}
-		set, err := rlepluslazy.RunsFromSlice(slc)
+	if len(set) > 0 {
+		setIter, err := rlepluslazy.RunsFromSortedSlice(set)
 		if err != nil {
 			return nil, err
 		}
-		newIter, err := rlepluslazy.Or(iter, set)
+		newIter, err := rlepluslazy.Or(iter, setIter)
 		if err != nil {
 			return nil, err
 		}
 		iter = newIter
 	}
-	if len(bf.unset) > 0 {
-		slc := make([]uint64, 0, len(bf.unset))
-		for b := range bf.unset {
-			slc = append(slc, b)
-		}
-
-		unset, err := rlepluslazy.RunsFromSlice(slc)
+	if len(unset) > 0 {
+		unsetIter, err := rlepluslazy.RunsFromSortedSlice(unset)
 		if err != nil {
 			return nil, err
 		}
-		newIter, err := rlepluslazy.Subtract(iter, unset)
+		newIter, err := rlepluslazy.Subtract(iter, unsetIter)
 		if err != nil {
 			return nil, err
 		}
@@ -311,6 +348,10 @@ func (bf BitField) Unset(bit uint64) {
 //
 // This operation's runtime is O(number of runs).
 func (bf BitField) Count() (uint64, error) {
+	if len(bf.set) == 0 && len(bf.unset) == 0 {
+		return bf.rle.Count()
+	}
+
 	s, err := bf.RunIterator()
 	if err != nil {
 		return 0, err
@@ -389,25 +430,14 @@ func (bf BitField) AllMap(max uint64) (map[uint64]bool, error) {
 }
 
 func (bf BitField) MarshalCBOR(w io.Writer) error {
-	var rle []byte
-	if len(bf.set) == 0 && len(bf.unset) == 0 {
-		// If unmodified, avoid re-encoding.
-		rle = bf.rle.Bytes()
-	} else {
-
-		s, err := bf.RunIterator()
-		if err != nil {
-			return err
-		}
-
-		rle, err = rlepluslazy.EncodeRuns(s, []byte{})
-		if err != nil {
-			return err
-		}
+	if len(bf.set) != 0 || len(bf.unset) != 0 {
+		return bf.streamCBOR(w)
 	}
 
-	if len(rle) > MaxEncodedSize {
-		return xerrors.Errorf("encoded bitfield was too large (%d)", len(rle))
+	// If unmodified, avoid re-encoding.
+	rle := bf.rle.Bytes()
+	if err := checkEncodedSize(uint64(len(rle))); err != nil {
+		return err
 	}
 
 	if _, err := w.Write(cbg.CborEncodeMajorType(cbg.MajByteString, uint64(len(rle)))); err != nil {
@@ -419,6 +449,62 @@ func (bf BitField) MarshalCBOR(w io.Writer) error {
 	return nil
 }
 
+// streamCBOR writes a modified bitfield without encoding it into a buffer
+// first. The runs are iterated twice: once to compute the encoded size for the
+// CBOR header, and once to write them. The changed bits are only sorted once.
+func (bf BitField) streamCBOR(w io.Writer) error {
+	set, unset := bf.sortedChanges()
+	s, err := bf.runIteratorWith(set, unset)
+	if err != nil {
+		return err
+	}
+	size, err := rlepluslazy.EncodedSize(s)
+	if err != nil {
+		return err
+	}
+	if err := checkEncodedSize(uint64(size)); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(cbg.CborEncodeMajorType(cbg.MajByteString, uint64(size))); err != nil {
+		return err
+	}
+
+	s, err = bf.runIteratorWith(set, unset)
+	if err != nil {
+		return err
+	}
+	cw := &countingWriter{w: w}
+	enc := rlepluslazy.NewEncoder(cw)
+	for s.HasNext() {
+		r, err := s.NextRun()
+		if err != nil {
+			return err
+		}
+		if err := enc.WriteRun(r); err != nil {
+			return xerrors.Errorf("writing rle: %w", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return xerrors.Errorf("writing rle: %w", err)
+	}
+	if cw.n != size {
+		return xerrors.Errorf("wrote %d bytes of rle, expected %d", cw.n, size)
+	}
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += n
+	return n, err
+}
+
 func (bf *BitField) UnmarshalCBOR(r io.Reader) error {
 	br := cbg.GetPeeker(r)
 
@@ -426,8 +512,8 @@ func (bf *BitField) UnmarshalCBOR(r io.Reader) error {
 	if err != nil {
 		return err
 	}
-	if extra > MaxEncodedSize {
-		return fmt.Errorf("array too large")
+	if err := checkEncodedSize(extra); err != nil {
+		return err
 	}
 
 	if maj != cbg.MajByteString {
@@ -460,9 +546,20 @@ func (bf BitField) MarshalJSON() ([]byte, error) {
 	return c.rle.MarshalJSON()
 }
 
+// UnmarshalJSON decodes a bitfield in any of the JSON formats, detecting which
+// one is used. Like UnmarshalCBOR, it rejects bitfields whose RLE+ encoding is
+// larger than MaxEncodedSize.
 func (bf *BitField) UnmarshalJSON(b []byte) error {
+	if format := detectJSONFormat(b); format != JSONRuns {
+		parsed, err := unmarshalJSONFormat(b, format)
+		if err != nil {
+			return err
+		}
+		*bf = parsed
+		return nil
+	}
 
-	err := bf.rle.UnmarshalJSON(b)
+	err := bf.rle.UnmarshalJSONLimited(b, MaxEncodedSize)
 	if err != nil {
 		return err
 	}
@@ -513,12 +610,7 @@ func (bf BitField) IsSet(x uint64) (bool, error) {
 		return false, nil
 	}
 
-	iter, err := bf.rle.RunIterator()
-	if err != nil {
-		return false, err
-	}
-
-	return rlepluslazy.IsSet(iter, x)
+	return bf.rle.IsSet(x)
 }
 
 // First returns the index of the first set bit. This function returns
@@ -526,6 +618,17 @@ func (bf BitField) IsSet(x uint64) (bool, error) {
 //
 // This operation's runtime is O(1).
 func (bf BitField) First() (uint64, error) {
+	if len(bf.set) == 0 && len(bf.unset) == 0 {
+		s, err := bf.rle.Summary()
+		if err != nil {
+			return 0, err
+		}
+		if s.Count == 0 {
+			return 0, ErrNoBitsSet
+		}
+		return s.First, nil
+	}
+
 	iter, err := bf.RunIterator()
 	if err != nil {
 		return 0, err
@@ -552,6 +655,17 @@ func (bf BitField) First() (uint64, error) {
 //
 // This operation's runtime is O(n).
 func (bf BitField) Last() (uint64, error) {
+	if len(bf.set) == 0 && len(bf.unset) == 0 {
+		s, err := bf.rle.Summary()
+		if err != nil {
+			return 0, err
+		}
+		if s.Count == 0 {
+			return 0, ErrNoBitsSet
+		}
+		return s.Last, nil
+	}
+
 	iter, err := bf.RunIterator()
 	if err != nil {
 		return 0, err
@@ -725,6 +839,34 @@ func IntersectBitField(a, b BitField) (BitField, error) {
 	return newWithRle(rle), nil
 }
 
+// MultiIntersect returns the intersection of all the passed BitFields. The
+// intersection of no BitFields is empty.
+//
+// Calling MultiIntersect is identical to calling IntersectBitField repeatedly,
+// just more efficient when intersecting more than two BitFields.
+//
+// This operation's runtime is O(number of runs * number of bitfields).
+func MultiIntersect(bfs ...BitField) (BitField, error) {
+	if len(bfs) == 0 {
+		return NewFromSet(nil), nil
+	}
+
+	iters := make([]rlepluslazy.RunIterator, 0, len(bfs))
+	for _, bf := range bfs {
+		iter, err := bf.RunIterator()
+		if err != nil {
+			return BitField{}, err
+		}
+		iters = append(iters, iter)
+	}
+
+	iter, err := rlepluslazy.Intersection(iters...)
+	if err != nil {
+		return BitField{}, err
+	}
+	return NewFromIter(iter)
+}
+
 // SubtractBitField returns the difference between the two BitFields. That is,
 // it returns a bitfield of all bits set in a but not set in b.
 //
@@ -788,6 +930,33 @@ func (bf BitField) Copy() (BitField, error) {
 	return newWithRle(rle), nil
 }
 
+// EncodedSize returns the size in bytes of the RLE+ encoding of the bitfield, as
+// written by MarshalCBOR (without the CBOR header), without encoding it.
+func (bf BitField) EncodedSize() (int, error) {
+	if len(bf.set) == 0 && len(bf.unset) == 0 {
+		return len(bf.rle.Bytes()), nil
+	}
+
+	r, err := bf.RunIterator()
+	if err != nil {
+		return 0, err
+	}
+	return rlepluslazy.EncodedSize(r)
+}
+
+// ToWords expands the BitField into a dense bitmap of universe bits, where bit
+// i is stored in bit i%64 of words[i/64]. It returns an error if any bit at or
+// beyond universe is set.
+//
+// This operation's runtime is O(number of runs + universe/64).
+func (bf BitField) ToWords(universe uint64) ([]uint64, error) {
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return nil, err
+	}
+	return rlepluslazy.WordsFromRuns(iter, universe)
+}
+
 // BitIterator iterates over the bits in the bitmap
 func (bf BitField) BitIterator() (rlepluslazy.BitIterator, error) {
 	r, err := bf.RunIterator()
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"math"
+	"math/bits"
+	"math/rand"
 	"testing"
 
 	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
 	"github.com/stretchr/testify/require"
+	cbg "github.com/whyrusleeping/cbor-gen"
 )
 
 func benchmark(b *testing.B, cb func(b *testing.B, bf BitField)) {
@@ -152,23 +156,6 @@ func BenchmarkBigAllocateSector(b *testing.B) {
 	}
 }
 
-func bitfieldStats(t *testing.T, bf BitField) (size int, runs uint64, last uint64) {
-	s, err := bf.RunIterator()
-	if err != nil {
-		t.Fatal(err)
-	}
-	for s.HasNext() {
-		run, err := s.NextRun()
-		if err != nil {
-			t.Fatal(err)
-		}
-		runs++
-		last += run.Len
-	}
-	size = len(bf.rle.Bytes())
-	return
-}
-
 func TestFillBitfieldUpTo(t *testing.T) {
 	bb, err := base64.StdEncoding.DecodeString(bigBitfield)
 	if err != nil {
@@ -179,14 +166,17 @@ func TestFillBitfieldUpTo(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	size, runs, last := bitfieldStats(t, bitF)
-	t.Logf("current size: %d, runs: %d, last %d", size, runs, last)
+	st, err := bitF.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("current size: %d, runs: %d, last %d", st.EncodedSize, st.Runs, st.Last)
 	s, err := bitF.RunIterator()
 	if err != nil {
 		t.Fatal(err)
 	}
 	trimmed, err := rlepluslazy.Or(s, &rlepluslazy.RunSliceIterator{
-		Runs: []rlepluslazy.Run{{Val: true, Len: last - 20<<10}},
+		Runs: []rlepluslazy.Run{{Val: true, Len: st.Last + 1 - 20<<10}},
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -199,8 +189,11 @@ func TestFillBitfieldUpTo(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	size, runs, last = bitfieldStats(t, bitFTrim)
-	t.Logf("trimed size: %d, runs: %d, last %d", size, runs, last)
+	st, err = bitFTrim.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("trimed size: %d, runs: %d, last %d", st.EncodedSize, st.Runs, st.Last)
 
 }
 
@@ -248,3 +241,126 @@ func BenchmarkBitfieldSubtractLargeElement(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkPartitionCount(b *testing.B) {
+	bf := NewFromSet(getRandIndexSetSeed(2349, 1))
+	bf, err := bf.Copy()
+	require.NoError(b, err)
+	words, err := bf.ToWords(2349)
+	require.NoError(b, err)
+
+	b.Run("rle", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := bf.Count(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("words", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var count int
+			for _, w := range words {
+				count += bits.OnesCount64(w)
+			}
+			Res += uint64(count)
+		}
+	})
+}
+
+func BenchmarkBigAllocateN(b *testing.B) {
+	bb, err := base64.StdEncoding.DecodeString(bigBitfield)
+	if err != nil {
+		b.Fatal(err)
+	}
+	bitF, err := NewFromBytes(bb)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, updated, err := bitF.AllocateN(1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = updated.MarshalCBOR(&bytes.Buffer{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkStateDecode decodes a block of many bitfields, as when walking the
+// partitions of a state tree.
+func BenchmarkStateDecode(b *testing.B) {
+	var buf bytes.Buffer
+	for i := int64(0); i < 100; i++ {
+		bf, err := NewFromIter(rlepluslazy.NewFromZipfDist(i, 2000))
+		require.NoError(b, err)
+		require.NoError(b, bf.MarshalCBOR(&buf))
+	}
+	block := buf.Bytes()
+
+	b.Run("reader", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			r := bytes.NewReader(block)
+			for r.Len() > 0 {
+				var bf BitField
+				if err := bf.UnmarshalCBOR(r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("bytes", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rest := block
+			for len(rest) > 0 {
+				var bf BitField
+				var err error
+				if rest, err = bf.UnmarshalCBORFromBytes(rest); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkMarshalCBORModified(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	set := make([]uint64, 3000)
+	for i := range set {
+		set[i] = uint64(r.Int63n(1 << 20))
+	}
+	bf := NewFromSet(set)
+
+	// buffered is how MarshalCBOR used to encode modified bitfields.
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s, err := bf.RunIterator()
+			if err != nil {
+				b.Fatal(err)
+			}
+			rle, err := rlepluslazy.EncodeRuns(s, []byte{})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := io.Discard.Write(cbg.CborEncodeMajorType(cbg.MajByteString, uint64(len(rle)))); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := io.Discard.Write(rle); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := bf.MarshalCBOR(io.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
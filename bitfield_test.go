@@ -7,12 +7,15 @@ import (
 	"math"
 	"math/rand"
 	"sort"
+	"strings"
 	"testing"
 
 	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
 )
 
 func slicesEqual(a, b []uint64) bool {
@@ -777,3 +780,186 @@ func TestLastEmpty(t *testing.T) {
 	_, err := bf.Last()
 	require.EqualError(t, err, ErrNoBitsSet.Error())
 }
+
+func TestBitfieldWords(t *testing.T) {
+	for i := int64(0); i < 10; i++ {
+		set := getRandIndexSetSeed(2349, i)
+		bf := NewFromSet(set)
+
+		words, err := bf.ToWords(2349)
+		require.NoError(t, err)
+		assert.Len(t, words, 37)
+
+		out, err := NewFromWords(words)
+		require.NoError(t, err)
+		bits, err := out.All(2349)
+		require.NoError(t, err)
+		assert.Equal(t, set, bits)
+	}
+
+	_, err := NewFromSet([]uint64{100}).ToWords(100)
+	assert.Error(t, err)
+}
+
+func TestBitfieldEncodedSize(t *testing.T) {
+	bf := NewFromSet(getRandIndexSet(5000))
+	expectSize := func() {
+		t.Helper()
+		var buf bytes.Buffer
+		require.NoError(t, bf.MarshalCBOR(&buf))
+		bs, err := cbg.ReadByteArray(&buf, MaxEncodedSize)
+		require.NoError(t, err)
+
+		size, err := bf.EncodedSize()
+		require.NoError(t, err)
+		assert.Equal(t, len(bs), size)
+	}
+
+	expectSize()
+	bf, err := bf.Copy()
+	require.NoError(t, err)
+	expectSize()
+
+	bf.Set(1 << 40)
+	bf.Unset(0)
+	expectSize()
+}
+
+func TestBitfieldCachedMetadata(t *testing.T) {
+	bf, err := NewFromSet([]uint64{3, 4, 5, 100}).Copy()
+	require.NoError(t, err)
+
+	check := func(count, first, last uint64) {
+		t.Helper()
+		c, err := bf.Count()
+		require.NoError(t, err)
+		assert.Equal(t, count, c)
+		f, err := bf.First()
+		require.NoError(t, err)
+		assert.Equal(t, first, f)
+		l, err := bf.Last()
+		require.NoError(t, err)
+		assert.Equal(t, last, l)
+	}
+
+	check(4, 3, 100)
+	check(4, 3, 100)
+
+	// Setting bits must not use the cached metadata.
+	bf.Set(1000)
+	bf.Unset(3)
+	check(4, 4, 1000)
+
+	var empty BitField
+	require.NoError(t, empty.UnmarshalJSON([]byte("[0]")))
+	_, err = empty.First()
+	assert.Equal(t, ErrNoBitsSet, err)
+	_, err = empty.Last()
+	assert.Equal(t, ErrNoBitsSet, err)
+	isEmpty, err := empty.IsEmpty()
+	require.NoError(t, err)
+	assert.True(t, isEmpty)
+}
+
+func TestBitfieldDecodeLimits(t *testing.T) {
+	// Each isolated bit takes at least 11 bits to encode, so this is just over
+	// the limit.
+	var sb strings.Builder
+	sb.WriteString("[0")
+	for i := 0; i < MaxEncodedSize*8/11+1; i++ {
+		sb.WriteString(",1,20")
+	}
+	sb.WriteString("]")
+	tooLarge := []byte(sb.String())
+
+	var rle rlepluslazy.RLE
+	require.NoError(t, rle.UnmarshalJSON(tooLarge))
+	require.Greater(t, len(rle.Bytes()), MaxEncodedSize)
+
+	var bf BitField
+	assert.Error(t, bf.UnmarshalJSON(tooLarge))
+
+	// The same bits are rejected in every format.
+	large, err := NewFromBytes(rle.Bytes())
+	require.NoError(t, err)
+	for _, format := range []JSONFormat{JSONBits, JSONRanges, JSONBase64} {
+		b, err := large.MarshalJSONFormat(format)
+		require.NoError(t, err)
+		err = bf.UnmarshalJSON(b)
+		assert.True(t, xerrors.Is(err, ErrBitFieldTooLarge), "format %d: %v", format, err)
+	}
+
+	var buf bytes.Buffer
+	err = large.MarshalCBOR(&buf)
+	assert.True(t, xerrors.Is(err, ErrBitFieldTooLarge))
+
+	buf.Reset()
+	_, err = buf.Write(cbg.CborEncodeMajorType(cbg.MajByteString, uint64(len(rle.Bytes()))))
+	require.NoError(t, err)
+	_, err = buf.Write(rle.Bytes())
+	require.NoError(t, err)
+	err = bf.UnmarshalCBOR(&buf)
+	assert.True(t, xerrors.Is(err, ErrBitFieldTooLarge))
+
+	// Runs past the end of the index are rejected.
+	assert.Error(t, bf.UnmarshalJSON([]byte("[18446744073709551615,1]")))
+	assert.Error(t, bf.UnmarshalJSON([]byte("[0,-1]")))
+}
+
+func TestMarshalCBORStreamingIdentical(t *testing.T) {
+	// encodeCBOR is the buffered encoding MarshalCBOR used to produce.
+	encodeCBOR := func(bf BitField) []byte {
+		s, err := bf.RunIterator()
+		require.NoError(t, err)
+		rle, err := rlepluslazy.EncodeRuns(s, []byte{})
+		require.NoError(t, err)
+		return append(cbg.CborEncodeMajorType(cbg.MajByteString, uint64(len(rle))), rle...)
+	}
+
+	check := func(bf BitField) {
+		t.Helper()
+		assert.Equal(t, encodeCBOR(bf), marshalBytes(t, bf))
+	}
+
+	// Unset every bit of a bitfield.
+	bf := NewFromSet([]uint64{5})
+	c, err := bf.Copy()
+	require.NoError(t, err)
+	c.Unset(5)
+	check(c)
+	c.Set(0)
+	check(c)
+
+	for i := int64(0); i < 50; i++ {
+		base, err := NewFromIter(rlepluslazy.NewFromZipfDist(i, int(i*40)))
+		require.NoError(t, err)
+		r := rand.New(rand.NewSource(i))
+		for j := 0; j < 20; j++ {
+			bit := uint64(r.Intn(int(i*40 + 100)))
+			if r.Intn(2) == 0 {
+				base.Set(bit)
+			} else {
+				base.Unset(bit)
+			}
+		}
+		check(base)
+	}
+
+	// Flushes of the encoder's buffer.
+	bf = NewFromSet(getRandIndexSet(100000))
+	check(bf)
+}
+
+func TestMarshalCBORStreamingTooLarge(t *testing.T) {
+	var set []uint64
+	for i := uint64(0); i < MaxEncodedSize*8/11+1; i++ {
+		set = append(set, i*22)
+	}
+	bf := NewFromSet(set)
+
+	var buf bytes.Buffer
+	err := bf.MarshalCBOR(&buf)
+	assert.True(t, xerrors.Is(err, ErrBitFieldTooLarge))
+	// Nothing is written if the bitfield is too large.
+	assert.Equal(t, 0, buf.Len())
+}
@@ -0,0 +1,88 @@
+package bitfield
+
+import (
+	"math/big"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+	"golang.org/x/xerrors"
+)
+
+// NewFromBitmapBytes constructs a BitField from a dense bitmap, where bit i is
+// stored in byte i/8 of buf at the position given by order.
+//
+// This operation's runtime is O(number of runs + number of bytes).
+func NewFromBitmapBytes(buf []byte, order rlepluslazy.BitNumbering) (BitField, error) {
+	return NewFromIter(rlepluslazy.RunsFromBytes(buf, order))
+}
+
+// NewFromBytesLSB constructs a BitField from a little-endian bitmap, where bit
+// i is stored in bit i%8 of buf[i/8].
+func NewFromBytesLSB(buf []byte) (BitField, error) {
+	return NewFromBitmapBytes(buf, rlepluslazy.LSB0)
+}
+
+// ToBitmapBytes expands the BitField into a dense bitmap of universe bits, where
+// bit i is stored in byte i/8 at the position given by order. It returns an
+// error if any bit at or beyond universe is set.
+//
+// This operation's runtime is O(number of runs + universe/8).
+func (bf BitField) ToBitmapBytes(universe uint64, order rlepluslazy.BitNumbering) ([]byte, error) {
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return nil, err
+	}
+	return rlepluslazy.BytesFromRuns(iter, universe, order)
+}
+
+// ToBytesLSB expands the BitField into a little-endian bitmap of universe bits,
+// where bit i is stored in bit i%8 of the result's byte i/8.
+func (bf BitField) ToBytesLSB(universe uint64) ([]byte, error) {
+	return bf.ToBitmapBytes(universe, rlepluslazy.LSB0)
+}
+
+// NewFromBigInt constructs a BitField from a bitmask, where bit i of the
+// BitField is set if bit i of x is set. x must not be negative.
+func NewFromBigInt(x *big.Int) (BitField, error) {
+	if x.Sign() < 0 {
+		return BitField{}, xerrors.Errorf("cannot construct bitfield from negative integer %s", x)
+	}
+
+	buf := x.Bytes()
+	reverseBytes(buf)
+	return NewFromBytesLSB(buf)
+}
+
+// maxBigIntBits is the largest bitmask ToBigInt will allocate, 512MiB.
+const maxBigIntBits = 1 << 32
+
+// ToBigInt returns the BitField as a bitmask, where bit i of the result is set if
+// bit i of the BitField is set. It returns an error if the last set bit is at or
+// beyond 2^32, as the bitmask would be too large to allocate.
+//
+// This operation's runtime is O(number of runs + index of the last set bit).
+func (bf BitField) ToBigInt() (*big.Int, error) {
+	last, err := bf.Last()
+	switch err {
+	case nil:
+	case ErrNoBitsSet:
+		return new(big.Int), nil
+	default:
+		return nil, err
+	}
+	if last >= maxBigIntBits {
+		return nil, xerrors.Errorf("bit %d is too large for a bitmask of at most %d bits", last, uint64(maxBigIntBits))
+	}
+
+	buf, err := bf.ToBytesLSB(last + 1)
+	if err != nil {
+		return nil, err
+	}
+	reverseBytes(buf)
+	return new(big.Int).SetBytes(buf), nil
+}
+
+func reverseBytes(buf []byte) {
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+}
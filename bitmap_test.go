@@ -0,0 +1,79 @@
+package bitfield
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitfieldBigInt(t *testing.T) {
+	for i := int64(0); i < 10; i++ {
+		set := getRandIndexSetSeed(1000, i)
+		bf := NewFromSet(set)
+
+		x, err := bf.ToBigInt()
+		require.NoError(t, err)
+
+		for b := 0; b < 1000; b++ {
+			isSet, err := bf.IsSet(uint64(b))
+			require.NoError(t, err)
+			assert.Equal(t, isSet, x.Bit(b) == 1, "bit %d", b)
+		}
+
+		out, err := NewFromBigInt(x)
+		require.NoError(t, err)
+		bits, err := out.All(1000)
+		require.NoError(t, err)
+		assert.Equal(t, set, bits)
+	}
+}
+
+func TestBitfieldBigIntEdges(t *testing.T) {
+	x, err := NewFromSet(nil).ToBigInt()
+	require.NoError(t, err)
+	assert.Zero(t, x.Sign())
+
+	bf, err := NewFromBigInt(big.NewInt(0b1010))
+	require.NoError(t, err)
+	bits, err := bf.All(10)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 3}, bits)
+
+	_, err = NewFromBigInt(big.NewInt(-1))
+	assert.Error(t, err)
+
+	// Bitmasks too large to allocate are rejected instead of panicking.
+	for _, bit := range []uint64{maxBigIntBits, 1 << 62, math.MaxUint64 - 1} {
+		_, err = NewFromSet([]uint64{bit}).ToBigInt()
+		assert.Error(t, err, "bit %d", bit)
+	}
+}
+
+func TestBitfieldBitmapBytes(t *testing.T) {
+	set := []uint64{0, 7, 8, 15, 16, 17, 18, 19, 20, 21, 22, 23}
+	bf := NewFromSet(set)
+
+	lsb, err := bf.ToBytesLSB(24)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x81, 0x81, 0xff}, lsb)
+
+	msb, err := bf.ToBitmapBytes(32, rlepluslazy.MSB0)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x81, 0x81, 0xff, 0x00}, msb)
+
+	out, err := NewFromBytesLSB(lsb)
+	require.NoError(t, err)
+	bits, err := out.All(100)
+	require.NoError(t, err)
+	assert.Equal(t, set, bits)
+
+	out, err = NewFromBitmapBytes([]byte{0x40}, rlepluslazy.MSB0)
+	require.NoError(t, err)
+	bits, err = out.All(100)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1}, bits)
+}
@@ -0,0 +1,65 @@
+package bitfield
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrBlockNotFound = errors.New("block not found")
+	ErrBlockMismatch = errors.New("block does not match its key")
+)
+
+// BlockStore is a minimal key-value store for the blocks of a ShardedBitField.
+//
+// Blocks are content addressed: the key is the hex encoded SHA-256 hash of the
+// data, so a given key is always put with the same data. ShardedBitField checks
+// the hash of every block it gets.
+type BlockStore interface {
+	Get(key string) ([]byte, error)
+	Put(key string, data []byte) error
+}
+
+// MemBlockStore is an in-memory BlockStore, mostly useful for testing.
+type MemBlockStore struct {
+	lk     sync.RWMutex
+	blocks map[string][]byte
+}
+
+var _ BlockStore = (*MemBlockStore)(nil)
+
+// NewMemBlockStore constructs a new, empty MemBlockStore.
+func NewMemBlockStore() *MemBlockStore {
+	return &MemBlockStore{blocks: make(map[string][]byte)}
+}
+
+// Get returns the block stored under key, or ErrBlockNotFound.
+//
+// Do not modify the returned slice.
+func (ms *MemBlockStore) Get(key string) ([]byte, error) {
+	ms.lk.RLock()
+	defer ms.lk.RUnlock()
+
+	data, ok := ms.blocks[key]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return data, nil
+}
+
+// Put stores a copy of data under key.
+func (ms *MemBlockStore) Put(key string, data []byte) error {
+	ms.lk.Lock()
+	defer ms.lk.Unlock()
+
+	ms.blocks[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// Len returns the number of blocks in the store.
+func (ms *MemBlockStore) Len() int {
+	ms.lk.RLock()
+	defer ms.lk.RUnlock()
+
+	return len(ms.blocks)
+}
@@ -0,0 +1,107 @@
+package bitfield
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// UnmarshalCBORFromBytes decodes a CBOR encoded bitfield from the start of b
+// without copying it, and returns the remaining bytes. It accepts the same
+// input as UnmarshalCBOR.
+//
+// The bitfield aliases b: b must not be modified while the bitfield, or any
+// bitfield sharing its encoding (e.g. a copy of the BitField value), is in use.
+// Setting and unsetting bits doesn't modify b. Use Copy to get a bitfield that
+// doesn't alias b.
+func (bf *BitField) UnmarshalCBORFromBytes(b []byte) (rest []byte, err error) {
+	maj, extra, b, err := readCborHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEncodedSize(extra); err != nil {
+		return nil, err
+	}
+
+	if maj != cbg.MajByteString {
+		return nil, fmt.Errorf("expected byte array")
+	}
+
+	if uint64(len(b)) < extra {
+		return nil, io.ErrUnexpectedEOF
+	}
+	// Limit the capacity so appending to the encoding can't overwrite the
+	// rest of b.
+	buf := b[:extra:extra]
+
+	rle, err := rlepluslazy.FromBuf(buf)
+	if err != nil {
+		return nil, xerrors.Errorf("could not decode rle+: %w", err)
+	}
+	bf.rle = rle
+	bf.set = make(map[uint64]struct{})
+	bf.unset = make(map[uint64]struct{})
+
+	return b[extra:], nil
+}
+
+// readCborHeader is cbg.CborReadHeader for a byte slice. It returns the bytes
+// after the header.
+func readCborHeader(b []byte) (maj byte, extra uint64, rest []byte, err error) {
+	if len(b) == 0 {
+		return 0, 0, nil, io.EOF
+	}
+	first := b[0]
+	b = b[1:]
+
+	maj = (first & 0xe0) >> 5
+	low := first & 0x1f
+
+	var n int
+	switch {
+	case low < 24:
+		return maj, uint64(low), b, nil
+	case low == 24:
+		n = 1
+	case low == 25:
+		n = 2
+	case low == 26:
+		n = 4
+	case low == 27:
+		n = 8
+	default:
+		return 0, 0, nil, fmt.Errorf("invalid header: (%x)", first)
+	}
+	if len(b) < n {
+		return 0, 0, nil, io.ErrUnexpectedEOF
+	}
+
+	switch n {
+	case 1:
+		extra = uint64(b[0])
+		if extra < 24 {
+			return 0, 0, nil, fmt.Errorf("cbor input was not canonical (lval 24 with value < 24)")
+		}
+	case 2:
+		extra = uint64(binary.BigEndian.Uint16(b))
+		if extra <= math.MaxUint8 {
+			return 0, 0, nil, fmt.Errorf("cbor input was not canonical (lval 25 with value <= MaxUint8)")
+		}
+	case 4:
+		extra = uint64(binary.BigEndian.Uint32(b))
+		if extra <= math.MaxUint16 {
+			return 0, 0, nil, fmt.Errorf("cbor input was not canonical (lval 26 with value <= MaxUint16)")
+		}
+	case 8:
+		extra = binary.BigEndian.Uint64(b)
+		if extra <= math.MaxUint32 {
+			return 0, 0, nil, fmt.Errorf("cbor input was not canonical (lval 27 with value <= MaxUint32)")
+		}
+	}
+	return maj, extra, b[n:], nil
+}
@@ -0,0 +1,95 @@
+package bitfield
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+func TestUnmarshalCBORFromBytes(t *testing.T) {
+	bfs := []BitField{
+		New(),
+		NewFromSet([]uint64{0}),
+		NewFromSet(getRandIndexSet(20)),
+		NewFromSet(getRandIndexSet(1000)),
+		NewFromSet(getRandIndexSet(100000)),
+	}
+
+	var buf bytes.Buffer
+	for _, bf := range bfs {
+		require.NoError(t, bf.MarshalCBOR(&buf))
+	}
+	b := buf.Bytes()
+
+	rest := b
+	for _, exp := range bfs {
+		var bf BitField
+		var err error
+		rest, err = bf.UnmarshalCBORFromBytes(rest)
+		require.NoError(t, err)
+		assertBitFieldEqual(t, exp, bf)
+
+		var viaReader BitField
+		require.NoError(t, viaReader.UnmarshalCBOR(bytes.NewReader(marshalBytes(t, exp))))
+		assert.Equal(t, viaReader.rle.Bytes(), bf.rle.Bytes())
+	}
+	assert.Empty(t, rest)
+}
+
+func TestUnmarshalCBORFromBytesModify(t *testing.T) {
+	b := marshalBytes(t, NewFromSet([]uint64{1, 2, 3}))
+	b = append(b, 0xff)
+
+	var bf BitField
+	rest, err := bf.UnmarshalCBORFromBytes(b)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xff}, rest)
+
+	// The encoding aliases the input, after the one byte header.
+	assert.True(t, &bf.rle.Bytes()[0] == &b[1])
+
+	// Modifying the bitfield doesn't modify the input.
+	orig := append([]byte(nil), b...)
+	bf.Set(10)
+	bf.Unset(1)
+	c, err := bf.Copy()
+	require.NoError(t, err)
+	assert.Equal(t, orig, b)
+	assertBitFieldEqual(t, NewFromSet([]uint64{2, 3, 10}), c)
+}
+
+func TestUnmarshalCBORFromBytesInvalid(t *testing.T) {
+	tooLarge := cbg.CborEncodeMajorType(cbg.MajByteString, MaxEncodedSize+1)
+
+	for _, tc := range []struct {
+		name string
+		in   []byte
+	}{
+		{"empty", nil},
+		{"not bytes", cbg.CborEncodeMajorType(cbg.MajArray, 1)},
+		{"truncated header", []byte{0x59, 0x01}},
+		{"non-canonical", []byte{0x58, 0x01, 0x00}},
+		{"truncated", []byte{0x43, 0x0c, 0x01}},
+		{"wrong version", []byte{0x41, 0x03}},
+		{"too large", tooLarge},
+		{"invalid header", []byte{0x5f}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var viaBytes, viaReader BitField
+			_, err := viaBytes.UnmarshalCBORFromBytes(tc.in)
+			assert.Error(t, err)
+			assert.Error(t, viaReader.UnmarshalCBOR(bytes.NewReader(tc.in)))
+		})
+	}
+
+	var bf BitField
+	_, err := bf.UnmarshalCBORFromBytes([]byte{0x43, 0x0c})
+	assert.True(t, xerrors.Is(err, io.ErrUnexpectedEOF))
+	_, err = bf.UnmarshalCBORFromBytes(tooLarge)
+	assert.True(t, xerrors.Is(err, ErrBitFieldTooLarge))
+}
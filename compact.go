@@ -0,0 +1,172 @@
+package bitfield
+
+import (
+	"math"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+)
+
+// Move renumbers a set bit.
+type Move struct {
+	From, To uint64
+}
+
+// CompactionPlan is a proposal to renumber bits of a bitfield to reduce its
+// number of runs, returned by Compact.
+type CompactionPlan struct {
+	// Moves lists the bits to move, in increasing order of To.
+	Moves []Move
+	// Result is the bitfield after applying the moves.
+	Result BitField
+
+	// SizeBefore and SizeAfter are the RLE+ encoded sizes of the bitfield
+	// before and after applying the moves.
+	SizeBefore, SizeAfter int
+	// RunsBefore and RunsAfter are the number of runs before and after
+	// applying the moves.
+	RunsBefore, RunsAfter uint64
+}
+
+// Savings returns the number of bytes saved by applying the plan.
+func (p CompactionPlan) Savings() int {
+	return p.SizeBefore - p.SizeAfter
+}
+
+// Compact plans moving up to maxMoves bits to fill the smallest holes between
+// runs of set bits, joining the runs around them. The highest set bits are
+// moved first, shrinking the bitfield from the end.
+//
+// The holes are found with JoinClose, using the largest closeness for which the
+// holes to fill add up to at most maxMoves bits. A bit is only moved to a lower
+// position.
+//
+// Compact doesn't modify bf; it only returns the plan and its predicted result.
+func Compact(bf BitField, maxMoves int) (CompactionPlan, error) {
+	before, err := bf.Stats()
+	if err != nil {
+		return CompactionPlan{}, err
+	}
+	plan := CompactionPlan{
+		SizeBefore: before.EncodedSize,
+		RunsBefore: before.Runs,
+	}
+
+	var holes []uint64
+	if maxMoves > 0 && before.LongestGap > 0 {
+		holes, err = smallHoles(bf, uint64(maxMoves), before.LongestGap)
+		if err != nil {
+			return CompactionPlan{}, err
+		}
+	}
+
+	// Pair the lowest holes with the highest set bits.
+	if len(holes) > 0 {
+		iter, err := bf.RunIterator()
+		if err != nil {
+			return CompactionPlan{}, err
+		}
+		var (
+			runs []rlepluslazy.Run
+			pos  uint64
+		)
+		for iter.HasNext() {
+			r, err := iter.NextRun()
+			if err != nil {
+				return CompactionPlan{}, err
+			}
+			runs = append(runs, r)
+			pos += r.Len
+		}
+
+		// Walk the runs backwards, taking bits from the end of each run of
+		// set bits.
+		i := len(runs) - 1
+		for _, hole := range holes {
+			for i >= 0 && (!runs[i].Val || runs[i].Len == 0) {
+				pos -= runs[i].Len
+				i--
+			}
+			if i < 0 || pos-1 < hole {
+				break
+			}
+			pos--
+			runs[i].Len--
+			plan.Moves = append(plan.Moves, Move{From: pos, To: hole})
+		}
+	}
+
+	from := make([]uint64, len(plan.Moves))
+	to := make([]uint64, len(plan.Moves))
+	for i, m := range plan.Moves {
+		from[i], to[i] = m.From, m.To
+	}
+	res, err := SubtractBitField(bf, NewFromSet(from))
+	if err != nil {
+		return CompactionPlan{}, err
+	}
+	res, err = MergeBitFields(res, NewFromSet(to))
+	if err != nil {
+		return CompactionPlan{}, err
+	}
+	plan.Result = res
+
+	after, err := res.Stats()
+	if err != nil {
+		return CompactionPlan{}, err
+	}
+	plan.SizeAfter = after.EncodedSize
+	plan.RunsAfter = after.Runs
+	return plan, nil
+}
+
+// smallHoles returns the unset bits in the holes joined by JoinClose with the
+// largest closeness for which there are at most maxBits of them.
+func smallHoles(bf BitField, maxBits, longestGap uint64) ([]uint64, error) {
+	holesAt := func(closeness uint64) (BitField, uint64, error) {
+		it, err := bf.RunIterator()
+		if err != nil {
+			return BitField{}, 0, err
+		}
+		joined, err := rlepluslazy.JoinClose(it, closeness)
+		if err != nil {
+			return BitField{}, 0, err
+		}
+		joinedBf, err := NewFromIter(joined)
+		if err != nil {
+			return BitField{}, 0, err
+		}
+		holes, err := SubtractBitField(joinedBf, bf)
+		if err != nil {
+			return BitField{}, 0, err
+		}
+		count, err := holes.Count()
+		if err != nil {
+			return BitField{}, 0, err
+		}
+		return holes, count, nil
+	}
+
+	// The number of hole bits grows with the closeness.
+	lo, hi := uint64(0), longestGap
+	for lo < hi {
+		mid := hi - (hi-lo)/2
+		_, count, err := holesAt(mid)
+		if err != nil {
+			return nil, err
+		}
+		if count <= maxBits {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	if lo == 0 {
+		return nil, nil
+	}
+
+	holes, _, err := holesAt(lo)
+	if err != nil {
+		return nil, err
+	}
+	return holes.All(math.MaxUint64)
+}
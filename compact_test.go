@@ -0,0 +1,79 @@
+package bitfield
+
+import (
+	"testing"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	// Holes of 1 at 3, 2 at 6 and 5 at 13.
+	bf := NewFromSet([]uint64{0, 1, 2, 4, 5, 8, 9, 10, 11, 12, 18, 19, 20, 21})
+	before := marshalBytes(t, bf)
+
+	plan, err := Compact(bf, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []Move{{From: 21, To: 3}, {From: 20, To: 6}, {From: 19, To: 7}}, plan.Moves)
+
+	bits, err := plan.Result.All(100)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 18}, bits)
+	assert.EqualValues(t, 7, plan.RunsBefore)
+	assert.EqualValues(t, 3, plan.RunsAfter)
+	size, err := plan.Result.EncodedSize()
+	require.NoError(t, err)
+	assert.Equal(t, size, plan.SizeAfter)
+	assert.Equal(t, plan.SizeBefore-plan.SizeAfter, plan.Savings())
+
+	// The input isn't modified.
+	assert.Equal(t, before, marshalBytes(t, bf))
+
+	// Not enough moves to fill any hole.
+	plan, err = Compact(bf, 0)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Moves)
+	assert.Equal(t, before, marshalBytes(t, plan.Result))
+
+	// Bits are never moved up.
+	plan, err = Compact(NewFromSet([]uint64{0, 2}), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []Move{{From: 2, To: 1}}, plan.Moves)
+
+	plan, err = Compact(New(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Moves)
+}
+
+func TestCompactRandom(t *testing.T) {
+	for i := int64(0); i < 10; i++ {
+		bf, err := NewFromIter(rlepluslazy.NewFromZipfDist(i, 1000))
+		require.NoError(t, err)
+		count, err := bf.Count()
+		require.NoError(t, err)
+
+		plan, err := Compact(bf, 500)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(plan.Moves), 500)
+		assert.LessOrEqual(t, plan.RunsAfter, plan.RunsBefore)
+
+		// Applying the moves gives the result.
+		for _, m := range plan.Moves {
+			assert.Less(t, m.To, m.From)
+			from, err := bf.IsSet(m.From)
+			require.NoError(t, err)
+			to, err := bf.IsSet(m.To)
+			require.NoError(t, err)
+			assert.True(t, from)
+			assert.False(t, to)
+		}
+		resCount, err := plan.Result.Count()
+		require.NoError(t, err)
+		assert.Equal(t, count, resCount)
+
+		t.Logf("seed %d: %d moves, %d -> %d bytes, %d -> %d runs", i, len(plan.Moves),
+			plan.SizeBefore, plan.SizeAfter, plan.RunsBefore, plan.RunsAfter)
+	}
+}
@@ -0,0 +1,78 @@
+package bitfield
+
+import (
+	"database/sql/driver"
+
+	"golang.org/x/xerrors"
+)
+
+// MarshalBinary returns the RLE+ encoding of the bitfield, as written by
+// MarshalCBOR without the CBOR header.
+func (bf BitField) MarshalBinary() ([]byte, error) {
+	var rle []byte
+	if len(bf.set) == 0 && len(bf.unset) == 0 {
+		// Copy, as the caller may modify the returned slice.
+		rle = append([]byte(nil), bf.rle.Bytes()...)
+	} else {
+		c, err := bf.Copy()
+		if err != nil {
+			return nil, err
+		}
+		rle = c.rle.Bytes()
+	}
+
+	if err := checkEncodedSize(uint64(len(rle))); err != nil {
+		return nil, err
+	}
+	return rle, nil
+}
+
+// UnmarshalBinary decodes RLE+ bytes, as returned by MarshalBinary. The
+// encoding is validated, and data is copied so the caller may reuse it.
+func (bf *BitField) UnmarshalBinary(data []byte) error {
+	if err := checkEncodedSize(uint64(len(data))); err != nil {
+		return err
+	}
+
+	parsed, err := NewFromBytes(append([]byte(nil), data...))
+	if err != nil {
+		return err
+	}
+	if err := parsed.rle.Validate(); err != nil {
+		return xerrors.Errorf("invalid rle+: %w", err)
+	}
+	*bf = parsed
+	return nil
+}
+
+// GobEncode encodes the bitfield for encoding/gob using MarshalBinary.
+func (bf BitField) GobEncode() ([]byte, error) {
+	return bf.MarshalBinary()
+}
+
+// GobDecode decodes a bitfield encoded with GobEncode.
+func (bf *BitField) GobDecode(data []byte) error {
+	return bf.UnmarshalBinary(data)
+}
+
+// Value stores the bitfield in a database as RLE+ bytes, for use in BLOB
+// columns.
+func (bf BitField) Value() (driver.Value, error) {
+	return bf.MarshalBinary()
+}
+
+// Scan reads a bitfield stored with Value. A NULL value is read as an empty
+// bitfield.
+func (bf *BitField) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*bf = New()
+		return nil
+	case []byte:
+		return bf.UnmarshalBinary(src)
+	case string:
+		return bf.UnmarshalBinary([]byte(src))
+	default:
+		return xerrors.Errorf("cannot scan %T into a bitfield", src)
+	}
+}
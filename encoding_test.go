@@ -0,0 +1,110 @@
+package bitfield
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = BitField{}
+	_ encoding.BinaryUnmarshaler = (*BitField)(nil)
+	_ gob.GobEncoder             = BitField{}
+	_ gob.GobDecoder             = (*BitField)(nil)
+	_ driver.Valuer              = BitField{}
+	_ sql.Scanner                = (*BitField)(nil)
+)
+
+func TestBitfieldBinary(t *testing.T) {
+	bf := NewFromSet(getRandIndexSet(1000))
+	var cbor bytes.Buffer
+	require.NoError(t, bf.MarshalCBOR(&cbor))
+	rle, err := cbg.ReadByteArray(&cbor, MaxEncodedSize)
+	require.NoError(t, err)
+
+	b, err := bf.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, rle, b)
+
+	var out BitField
+	require.NoError(t, out.UnmarshalBinary(b))
+	assertBitFieldEqual(t, bf, out)
+
+	// The input isn't retained.
+	for i := range b {
+		b[i] = 0xff
+	}
+	assertBitFieldEqual(t, bf, out)
+
+	// Modified bitfields are re-encoded.
+	bf.Set(5000)
+	b, err = bf.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, out.UnmarshalBinary(b))
+	assertBitFieldEqual(t, bf, out)
+
+	// Empty bitfields round trip.
+	b, err = New().MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, out.UnmarshalBinary(b))
+	empty, err := out.IsEmpty()
+	require.NoError(t, err)
+	assert.True(t, empty)
+}
+
+func TestBitfieldUnmarshalBinaryInvalid(t *testing.T) {
+	var bf BitField
+	// Trailing zero byte.
+	assert.Error(t, bf.UnmarshalBinary([]byte{0x0c, 0x00}))
+	// Wrong version.
+	assert.Error(t, bf.UnmarshalBinary([]byte{0x03}))
+
+	err := bf.UnmarshalBinary(make([]byte, MaxEncodedSize+1))
+	assert.True(t, xerrors.Is(err, ErrBitFieldTooLarge))
+}
+
+func TestBitfieldGob(t *testing.T) {
+	type record struct {
+		Name    string
+		Sectors BitField
+	}
+	in := record{Name: "deadline", Sectors: NewFromSet([]uint64{1, 2, 3, 100})}
+	in.Sectors.Unset(2)
+
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(in))
+
+	var out record
+	require.NoError(t, gob.NewDecoder(&buf).Decode(&out))
+	assert.Equal(t, in.Name, out.Name)
+	assertBitFieldEqual(t, in.Sectors, out.Sectors)
+}
+
+func TestBitfieldSQL(t *testing.T) {
+	bf := NewFromSet([]uint64{0, 4, 5, 6, 1 << 40})
+	v, err := bf.Value()
+	require.NoError(t, err)
+	require.IsType(t, []byte{}, v)
+
+	var out BitField
+	require.NoError(t, out.Scan(v))
+	assertBitFieldEqual(t, bf, out)
+
+	require.NoError(t, out.Scan(string(v.([]byte))))
+	assertBitFieldEqual(t, bf, out)
+
+	require.NoError(t, out.Scan(nil))
+	empty, err := out.IsEmpty()
+	require.NoError(t, err)
+	assert.True(t, empty)
+
+	assert.Error(t, out.Scan(int64(1)))
+}
@@ -0,0 +1,112 @@
+package bitfield
+
+import (
+	"sort"
+
+	"golang.org/x/xerrors"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+)
+
+// JoinClose returns the bitfield with runs of set bits separated by at most
+// closeness unset bits joined, by setting the bits between them.
+//
+// This operation's runtime is O(number of runs).
+func (bf BitField) JoinClose(closeness uint64) (BitField, error) {
+	iter, err := bf.joinClose(closeness)
+	if err != nil {
+		return BitField{}, err
+	}
+	return NewFromIter(iter)
+}
+
+func (bf BitField) joinClose(closeness uint64) (rlepluslazy.RunIterator, error) {
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return nil, err
+	}
+	return rlepluslazy.JoinClose(iter, closeness)
+}
+
+// JoinToFit approximates the bitfield by joining close runs of set bits until
+// it encodes to at most maxEncodedBytes. It finds the smallest closeness that
+// fits, and returns the joined bitfield and the bits that were added to it.
+//
+// This operation's runtime is O(number of distinct gaps * number of runs).
+//
+// If the bitfield already fits, it's returned unchanged with no added bits. An
+// error is returned if it doesn't fit even with all runs joined.
+func (bf BitField) JoinToFit(maxEncodedBytes int) (joined, added BitField, err error) {
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return BitField{}, BitField{}, err
+	}
+
+	// Collect the distinct gaps between runs of set bits; these are the only
+	// closeness values that make a difference.
+	var (
+		gaps  []uint64
+		seen  = make(map[uint64]struct{})
+		first = true
+	)
+	for iter.HasNext() {
+		r, err := iter.NextRun()
+		if err != nil {
+			return BitField{}, BitField{}, err
+		}
+		if !r.Val && !first {
+			if _, ok := seen[r.Len]; !ok {
+				seen[r.Len] = struct{}{}
+				gaps = append(gaps, r.Len)
+			}
+		}
+		first = false
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+
+	fits := func(closeness uint64) (bool, error) {
+		iter, err := bf.joinClose(closeness)
+		if err != nil {
+			return false, err
+		}
+		size, err := rlepluslazy.EncodedSize(iter)
+		if err != nil {
+			return false, err
+		}
+		return size <= maxEncodedBytes, nil
+	}
+
+	// Closeness 0 doesn't join anything.
+	if ok, err := fits(0); err != nil {
+		return BitField{}, BitField{}, err
+	} else if ok {
+		return bf, New(), nil
+	}
+
+	// Joining runs usually shrinks the encoding, but not always: three runs of
+	// length 1 take 3 bits, while a single run of length 3 takes 6. So the
+	// gaps are tried in order rather than binary searched.
+	i := 0
+	for ; i < len(gaps); i++ {
+		ok, err := fits(gaps[i])
+		if err != nil {
+			return BitField{}, BitField{}, err
+		}
+		if ok {
+			break
+		}
+	}
+	if i == len(gaps) {
+		return BitField{}, BitField{}, xerrors.Errorf("bitfield doesn't fit in %d bytes with all runs joined", maxEncodedBytes)
+	}
+
+	joined, err = bf.JoinClose(gaps[i])
+	if err != nil {
+		return BitField{}, BitField{}, err
+	}
+	added, err = SubtractBitField(joined, bf)
+	if err != nil {
+		return BitField{}, BitField{}, err
+	}
+	return joined, added, nil
+}
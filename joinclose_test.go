@@ -0,0 +1,119 @@
+package bitfield
+
+import (
+	"testing"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBitfieldJoinClose(t *testing.T) {
+	bf := NewFromSet([]uint64{0, 1, 3, 4, 7, 8, 20})
+
+	joined, err := bf.JoinClose(2)
+	require.NoError(t, err)
+	bits, err := joined.All(100)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 20}, bits)
+
+	joined, err = bf.JoinClose(0)
+	require.NoError(t, err)
+	assert.Equal(t, marshalBytes(t, bf), marshalBytes(t, joined))
+}
+
+func TestJoinToFit(t *testing.T) {
+	bf, err := NewFromIter(rlepluslazy.NewFromZipfDist(3, 2000))
+	require.NoError(t, err)
+	size, err := bf.EncodedSize()
+	require.NoError(t, err)
+
+	for _, max := range []int{size, size / 2, size / 10, 8} {
+		joined, added, err := bf.JoinToFit(max)
+		require.NoError(t, err)
+
+		joinedSize, err := joined.EncodedSize()
+		require.NoError(t, err)
+		assert.LessOrEqual(t, joinedSize, max)
+
+		// The joined bitfield is the original plus the added bits.
+		union, err := MergeBitFields(bf, added)
+		require.NoError(t, err)
+		assert.Equal(t, marshalBytes(t, joined), marshalBytes(t, union))
+		overlap, err := IntersectBitField(bf, added)
+		require.NoError(t, err)
+		empty, err := overlap.IsEmpty()
+		require.NoError(t, err)
+		assert.True(t, empty)
+
+		count, err := added.Count()
+		require.NoError(t, err)
+		t.Logf("max %5d bytes: %5d bytes, %d bits added", max, joinedSize, count)
+		if max == size {
+			assert.Zero(t, count)
+		}
+	}
+
+	_, _, err = bf.JoinToFit(1)
+	assert.Error(t, err)
+}
+
+func TestJoinToFitSmallest(t *testing.T) {
+	// Joining the gaps of 1 is enough, the gap of 100 must stay.
+	var set []uint64
+	for i := uint64(0); i < 100; i += 2 {
+		set = append(set, i)
+	}
+	bf := NewFromSet(append(set, 199))
+
+	joined, added, err := bf.JoinToFit(8)
+	require.NoError(t, err)
+	count, err := added.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 49, count)
+	last, err := joined.Last()
+	require.NoError(t, err)
+	assert.EqualValues(t, 199, last)
+}
+
+func TestJoinToFitNotMonotonic(t *testing.T) {
+	// Pairs of isolated bits separated by a one bit gap: joining the gaps of 1
+	// turns three runs of 1 (3 bits) into a run of 3 (6 bits), growing the
+	// encoding, while joining everything shrinks it.
+	var set []uint64
+	for i := uint64(0); i < 20; i++ {
+		set = append(set, i*1000, i*1000+2)
+	}
+	bf := NewFromSet(set)
+	size, err := bf.EncodedSize()
+	require.NoError(t, err)
+	require.Equal(t, 51, size)
+
+	oneJoined, err := bf.JoinClose(1)
+	require.NoError(t, err)
+	oneSize, err := oneJoined.EncodedSize()
+	require.NoError(t, err)
+	require.Greater(t, oneSize, size)
+
+	// The input already fits, so it's returned unchanged.
+	joined, added, err := bf.JoinToFit(size)
+	require.NoError(t, err)
+	assert.Equal(t, marshalBytes(t, bf), marshalBytes(t, joined))
+	empty, err := added.IsEmpty()
+	require.NoError(t, err)
+	assert.True(t, empty)
+
+	// Otherwise the gap of 1 doesn't help and everything is joined.
+	joined, added, err = bf.JoinToFit(size - 1)
+	require.NoError(t, err)
+	joinedSize, err := joined.EncodedSize()
+	require.NoError(t, err)
+	assert.LessOrEqual(t, joinedSize, size-1)
+	count, err := joined.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 19003, count)
+	addedCount, err := added.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 19003-40, addedCount)
+}
@@ -0,0 +1,168 @@
+package bitfield
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"golang.org/x/xerrors"
+)
+
+// JSONFormat selects how a BitField is encoded as JSON. UnmarshalJSON accepts
+// all of the formats.
+type JSONFormat int
+
+const (
+	// JSONRuns encodes the run lengths, always starting with a run of zeros,
+	// such as [0, 3, 5, 2] for the bits 0-2 and 8-9. This is the default
+	// used by MarshalJSON.
+	JSONRuns JSONFormat = iota
+	// JSONBits encodes the set bits, such as {"bits": [0, 1, 2, 8, 9]}.
+	JSONBits
+	// JSONRanges encodes inclusive ranges of set bits, such as
+	// [[0, 2], [8, 9]].
+	JSONRanges
+	// JSONBase64 encodes the RLE+ bytes as a base64 string.
+	JSONBase64
+)
+
+// FormattedJSON is a BitField that is marshalled to JSON in the given format.
+type FormattedJSON struct {
+	BitField
+	Format JSONFormat
+}
+
+// AsBits wraps bf to be marshalled as a list of set bits.
+func AsBits(bf BitField) FormattedJSON {
+	return FormattedJSON{BitField: bf, Format: JSONBits}
+}
+
+// AsRanges wraps bf to be marshalled as a list of ranges.
+func AsRanges(bf BitField) FormattedJSON {
+	return FormattedJSON{BitField: bf, Format: JSONRanges}
+}
+
+// AsBase64 wraps bf to be marshalled as base64 RLE+.
+func AsBase64(bf BitField) FormattedJSON {
+	return FormattedJSON{BitField: bf, Format: JSONBase64}
+}
+
+func (f FormattedJSON) MarshalJSON() ([]byte, error) {
+	return f.BitField.MarshalJSONFormat(f.Format)
+}
+
+type jsonBits struct {
+	Bits []uint64 `json:"bits"`
+}
+
+// MarshalJSONFormat encodes the bitfield as JSON in the given format.
+func (bf BitField) MarshalJSONFormat(format JSONFormat) ([]byte, error) {
+	switch format {
+	case JSONRuns:
+		return bf.MarshalJSON()
+	case JSONBits:
+		bits := []uint64{}
+		if err := bf.ForEach(func(b uint64) error {
+			bits = append(bits, b)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		return json.Marshal(jsonBits{Bits: bits})
+	case JSONRanges:
+		iter, err := bf.RunIterator()
+		if err != nil {
+			return nil, err
+		}
+		ranges := [][2]uint64{}
+		var pos uint64
+		for iter.HasNext() {
+			r, err := iter.NextRun()
+			if err != nil {
+				return nil, err
+			}
+			if r.Val {
+				ranges = append(ranges, [2]uint64{pos, pos + r.Len - 1})
+			}
+			pos += r.Len
+		}
+		return json.Marshal(ranges)
+	case JSONBase64:
+		c, err := bf.Copy()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(c.rle.Bytes())
+	default:
+		return nil, xerrors.Errorf("unknown JSON format %d", format)
+	}
+}
+
+// detectJSONFormat returns the format of the encoded bitfield.
+func detectJSONFormat(b []byte) JSONFormat {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	if len(b) == 0 {
+		return JSONRuns
+	}
+	switch b[0] {
+	case '"':
+		return JSONBase64
+	case '{':
+		return JSONBits
+	case '[':
+		if rest := bytes.TrimLeft(b[1:], " \t\r\n"); len(rest) > 0 && rest[0] == '[' {
+			return JSONRanges
+		}
+	}
+	return JSONRuns
+}
+
+// unmarshalJSONFormat decodes a bitfield in any format other than JSONRuns.
+func unmarshalJSONFormat(b []byte, format JSONFormat) (BitField, error) {
+	switch format {
+	case JSONBits:
+		var bits jsonBits
+		if err := json.Unmarshal(b, &bits); err != nil {
+			return BitField{}, err
+		}
+		var rb rangeBuilder
+		for _, bit := range bits.Bits {
+			if err := rb.add(bit, bit); err != nil {
+				return BitField{}, xerrors.Errorf("bit %d: %w", bit, err)
+			}
+		}
+		return rb.limitedBitField()
+	case JSONRanges:
+		var ranges [][]uint64
+		if err := json.Unmarshal(b, &ranges); err != nil {
+			return BitField{}, err
+		}
+		var rb rangeBuilder
+		for i, r := range ranges {
+			if len(r) != 2 {
+				return BitField{}, xerrors.Errorf("range %d: expected [start, end], got %d elements", i, len(r))
+			}
+			if err := rb.add(r[0], r[1]); err != nil {
+				return BitField{}, xerrors.Errorf("range [%d, %d]: %w", r[0], r[1], err)
+			}
+		}
+		return rb.limitedBitField()
+	case JSONBase64:
+		var buf []byte
+		if err := json.Unmarshal(b, &buf); err != nil {
+			return BitField{}, err
+		}
+		if err := checkEncodedSize(uint64(len(buf))); err != nil {
+			return BitField{}, err
+		}
+		bf, err := NewFromBytes(buf)
+		if err != nil {
+			return BitField{}, err
+		}
+		if err := bf.rle.Validate(); err != nil {
+			return BitField{}, xerrors.Errorf("invalid RLE+: %w", err)
+		}
+		return bf, nil
+	default:
+		return BitField{}, xerrors.Errorf("unknown JSON format %d", format)
+	}
+}
@@ -0,0 +1,158 @@
+package bitfield
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ json.Marshaler = FormattedJSON{}
+
+func TestJSONFormats(t *testing.T) {
+	bf := NewFromSet([]uint64{0, 1, 2, 8, 9})
+
+	for _, tc := range []struct {
+		name   string
+		format JSONFormat
+		json   string
+	}{
+		{"runs", JSONRuns, `[0,3,5,2]`},
+		{"bits", JSONBits, `{"bits":[0,1,2,8,9]}`},
+		{"ranges", JSONRanges, `[[0,2],[8,9]]`},
+		{"base64", JSONBase64, `"dCwF"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := bf.MarshalJSONFormat(tc.format)
+			require.NoError(t, err)
+			assert.Equal(t, tc.json, string(b))
+
+			wrapped, err := json.Marshal(FormattedJSON{BitField: bf, Format: tc.format})
+			require.NoError(t, err)
+			assert.Equal(t, tc.json, string(wrapped))
+
+			var out BitField
+			require.NoError(t, json.Unmarshal(b, &out))
+			assertBitFieldEqual(t, bf, out)
+		})
+	}
+}
+
+func TestJSONDefaultFormat(t *testing.T) {
+	bf := NewFromSet([]uint64{3, 4, 10})
+	b, err := json.Marshal(bf)
+	require.NoError(t, err)
+	assert.Equal(t, `[3,2,5,1]`, string(b))
+
+	b, err = json.Marshal(struct {
+		Default BitField
+		Ranges  FormattedJSON
+		Bits    FormattedJSON
+		Base64  FormattedJSON
+	}{bf, AsRanges(bf), AsBits(bf), AsBase64(bf)})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Default":[3,2,5,1],"Ranges":[[3,4],[10,10]],"Bits":{"bits":[3,4,10]},"Base64":"cBQr"}`, string(b))
+}
+
+func TestJSONFormatsRoundTrip(t *testing.T) {
+	bf := NewFromSet(getRandIndexSet(2000))
+	bf.Set(math.MaxUint64 - 1)
+	for _, format := range []JSONFormat{JSONRuns, JSONBits, JSONRanges, JSONBase64} {
+		b, err := bf.MarshalJSONFormat(format)
+		require.NoError(t, err)
+
+		var out BitField
+		require.NoError(t, out.UnmarshalJSON(b), "format %d", format)
+		assertBitFieldEqual(t, bf, out)
+	}
+}
+
+func TestJSONFormatsEmpty(t *testing.T) {
+	bf := New()
+	for format, exp := range map[JSONFormat]string{
+		JSONRuns:   `[0]`,
+		JSONBits:   `{"bits":[]}`,
+		JSONRanges: `[]`,
+		JSONBase64: `""`,
+	} {
+		b, err := bf.MarshalJSONFormat(format)
+		require.NoError(t, err)
+		assert.Equal(t, exp, string(b))
+
+		var out BitField
+		require.NoError(t, out.UnmarshalJSON(b), "format %d", format)
+		empty, err := out.IsEmpty()
+		require.NoError(t, err)
+		assert.True(t, empty)
+	}
+
+	_, err := bf.MarshalJSONFormat(JSONFormat(42))
+	assert.Error(t, err)
+}
+
+func TestUnmarshalJSONFormatsInvalid(t *testing.T) {
+	for _, in := range []string{
+		`{"bits":[3,1]}`,
+		`{"bits":[1,1]}`,
+		`{"bits":[18446744073709551615]}`,
+		`{"bits":"1"}`,
+		`[[4,2]]`,
+		`[[0,2],[1,3]]`,
+		`[[0,2],["a",3]]`,
+		`[[0,5,100],[200,300,7]]`,
+		`[[0,2],[4]]`,
+		`[[0,2],[]]`,
+		`[[0,2],null]`,
+		`"not base64"`,
+		`"AA=="`,
+	} {
+		var bf BitField
+		assert.Error(t, bf.UnmarshalJSON([]byte(in)), in)
+	}
+}
+
+func TestUnmarshalJSONFormatsWhitespace(t *testing.T) {
+	var bf BitField
+	require.NoError(t, bf.UnmarshalJSON([]byte(" \n[ [0, 2], [4, 4] ]")))
+	assertBitFieldEqual(t, NewFromSet([]uint64{0, 1, 2, 4}), bf)
+
+	require.NoError(t, bf.UnmarshalJSON([]byte(" [1, 2]")))
+	assertBitFieldEqual(t, NewFromSet([]uint64{1, 2}), bf)
+
+	// Adjacent ranges are merged.
+	require.NoError(t, bf.UnmarshalJSON([]byte(`[[0,2],[3,4]]`)))
+	assertBitFieldEqual(t, NewFromSet([]uint64{0, 1, 2, 3, 4}), bf)
+}
+
+func assertBitFieldEqual(t *testing.T, exp, act BitField) {
+	t.Helper()
+	expBits, err := exp.All(math.MaxUint64)
+	require.NoError(t, err)
+	actBits, err := act.All(math.MaxUint64)
+	require.NoError(t, err)
+	assert.Equal(t, expBits, actBits)
+}
+
+func TestUnmarshalJSONNull(t *testing.T) {
+	var s struct {
+		B BitField
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"B":null}`), &s))
+	empty, err := s.B.IsEmpty()
+	require.NoError(t, err)
+	assert.True(t, empty)
+
+	bf := NewFromSet([]uint64{1, 2})
+	require.NoError(t, bf.UnmarshalJSON([]byte("null")))
+	empty, err = bf.IsEmpty()
+	require.NoError(t, err)
+	assert.True(t, empty)
+
+	// The bitfield is usable after decoding null.
+	bf.Set(3)
+	count, err := bf.Count()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), count)
+}
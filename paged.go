@@ -0,0 +1,355 @@
+package bitfield
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+	"golang.org/x/xerrors"
+)
+
+var ErrInvalidPageSize = errors.New("page size must be non-zero")
+
+// PagedBitField is a bitfield that partitions the index space into fixed-size
+// pages, each stored as a separate RLE+ bitfield. Unlike BitField, it isn't
+// limited by MaxEncodedSize, so it can track sets over the entire uint64 index
+// space. Pages without any set bits are not stored.
+//
+// PagedBitField implements RunIterable, so it can be combined with the run
+// iterators in the rle package like any other bitfield.
+//
+// The zero value is an empty bitfield without a page size. Use NewPaged or
+// NewPagedFromIter to construct a PagedBitField; methods that need the page
+// size return ErrInvalidPageSize on the zero value.
+type PagedBitField struct {
+	pageSize uint64
+	pages    map[uint64]rlepluslazy.RLE
+}
+
+// NewPaged constructs a new, empty PagedBitField with the given page size. It
+// panics if pageSize is zero.
+func NewPaged(pageSize uint64) PagedBitField {
+	if pageSize == 0 {
+		panic(ErrInvalidPageSize)
+	}
+	return PagedBitField{
+		pageSize: pageSize,
+		pages:    make(map[uint64]rlepluslazy.RLE),
+	}
+}
+
+// NewPagedFromIter constructs a PagedBitField with the given page size from the
+// RunIterator.
+//
+// This operation's runtime is O(number of runs + number of pages).
+func NewPagedFromIter(pageSize uint64, r rlepluslazy.RunIterator) (PagedBitField, error) {
+	if pageSize == 0 {
+		return PagedBitField{}, ErrInvalidPageSize
+	}
+	pb := NewPaged(pageSize)
+	err := splitPages(r, pageSize, func(page uint64, runs []rlepluslazy.Run) error {
+		buf, err := rlepluslazy.EncodeRuns(&rlepluslazy.RunSliceIterator{Runs: runs}, nil)
+		if err != nil {
+			return err
+		}
+		rle, err := rlepluslazy.FromBuf(buf)
+		if err != nil {
+			return err
+		}
+		pb.pages[page] = rle
+		return nil
+	})
+	if err != nil {
+		return PagedBitField{}, err
+	}
+	return pb, nil
+}
+
+// PageSize returns the number of bits covered by each page.
+func (pb PagedBitField) PageSize() uint64 {
+	return pb.pageSize
+}
+
+// NumPages returns the number of non-empty pages.
+func (pb PagedBitField) NumPages() int {
+	return len(pb.pages)
+}
+
+// RunIterator returns an iterator over the runs of the entire bitfield,
+// concatenating the runs of each page in order.
+func (pb PagedBitField) RunIterator() (rlepluslazy.RunIterator, error) {
+	keys := make([]uint64, 0, len(pb.pages))
+	for k := range pb.pages {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	return newPageIterator(pb.pageSize, keys, func(page uint64) (rlepluslazy.RunIterator, error) {
+		rle := pb.pages[page]
+		return rle.RunIterator()
+	})
+}
+
+// IsSet returns true if the given bit is set.
+//
+// This operation's runtime is O(number of runs in the bit's page).
+func (pb PagedBitField) IsSet(x uint64) (bool, error) {
+	if pb.pageSize == 0 {
+		return false, ErrInvalidPageSize
+	}
+	rle, ok := pb.pages[x/pb.pageSize]
+	if !ok {
+		return false, nil
+	}
+	iter, err := rle.RunIterator()
+	if err != nil {
+		return false, err
+	}
+	return rlepluslazy.IsSet(iter, x%pb.pageSize)
+}
+
+// Count counts the non-zero bits in the bitfield.
+//
+// This operation's runtime is O(number of runs).
+func (pb PagedBitField) Count() (uint64, error) {
+	var count uint64
+	for _, rle := range pb.pages {
+		c, err := rle.Count()
+		if err != nil {
+			return 0, err
+		}
+		count += c
+	}
+	return count, nil
+}
+
+// Set sets the given bit in the PagedBitField.
+//
+// This operation's runtime is O(number of runs in the bit's page).
+func (pb PagedBitField) Set(bit uint64) error {
+	return pb.updatePage(bit, rlepluslazy.Or)
+}
+
+// Unset unsets the given bit in the PagedBitField.
+//
+// This operation's runtime is O(number of runs in the bit's page).
+func (pb PagedBitField) Unset(bit uint64) error {
+	return pb.updatePage(bit, rlepluslazy.Subtract)
+}
+
+// updatePage re-encodes the page containing bit after combining it with a
+// single-bit iterator using op.
+func (pb PagedBitField) updatePage(bit uint64, op pageOp) error {
+	if pb.pageSize == 0 {
+		return ErrInvalidPageSize
+	}
+	page := bit / pb.pageSize
+
+	rle, err := updateRLE(pb.pages[page], bit%pb.pageSize, op)
+	if err != nil {
+		return err
+	}
+
+	if len(rle.Bytes()) == 0 {
+		delete(pb.pages, page)
+	} else {
+		pb.pages[page] = rle
+	}
+	return nil
+}
+
+type pageOp func(a, b rlepluslazy.RunIterator) (rlepluslazy.RunIterator, error)
+
+// updateRLE returns the RLE+ bitfield resulting from combining rle with a
+// single-bit iterator using op.
+func updateRLE(rle rlepluslazy.RLE, bit uint64, op pageOp) (rlepluslazy.RLE, error) {
+	iter, err := rle.RunIterator()
+	if err != nil {
+		return rlepluslazy.RLE{}, err
+	}
+	single, err := rlepluslazy.RunsFromSlice([]uint64{bit})
+	if err != nil {
+		return rlepluslazy.RLE{}, err
+	}
+	iter, err = op(iter, single)
+	if err != nil {
+		return rlepluslazy.RLE{}, err
+	}
+	buf, err := rlepluslazy.EncodeRuns(iter, nil)
+	if err != nil {
+		return rlepluslazy.RLE{}, err
+	}
+	return rlepluslazy.FromBuf(buf)
+}
+
+// splitPages splits the runs in r into pages of pageSize bits and calls emit
+// for each page with at least one set bit, in ascending page order. The runs
+// passed to emit are relative to the start of the page and are only valid
+// until emit returns.
+func splitPages(r rlepluslazy.RunIterator, pageSize uint64, emit func(page uint64, runs []rlepluslazy.Run) error) error {
+	var (
+		pos, page, fill uint64
+		runs            []rlepluslazy.Run
+	)
+	flush := func() error {
+		if len(runs) == 0 {
+			return nil
+		}
+		err := emit(page, runs)
+		runs = runs[:0]
+		fill = 0
+		return err
+	}
+
+	for r.HasNext() {
+		run, err := r.NextRun()
+		if err != nil {
+			return err
+		}
+		if math.MaxUint64-run.Len < pos {
+			return xerrors.New("RLE+ overflows")
+		}
+		if !run.Val {
+			pos += run.Len
+			continue
+		}
+
+		for run.Len > 0 {
+			if p := pos / pageSize; p != page {
+				if err := flush(); err != nil {
+					return err
+				}
+				page = p
+			}
+
+			off := pos % pageSize
+			if off > fill {
+				runs = append(runs, rlepluslazy.Run{Val: false, Len: off - fill})
+			}
+			n := pageSize - off
+			if run.Len < n {
+				n = run.Len
+			}
+			runs = append(runs, rlepluslazy.Run{Val: true, Len: n})
+
+			fill = off + n
+			pos += n
+			run.Len -= n
+		}
+	}
+	return flush()
+}
+
+// pageIterator concatenates the runs of a sorted list of pages into a single
+// RunIterator, filling the space between pages with zeros and joining runs
+// that continue across page boundaries.
+type pageIterator struct {
+	pageSize uint64
+	pages    []uint64
+	load     func(page uint64) (rlepluslazy.RunIterator, error)
+
+	cur     rlepluslazy.RunIterator
+	pos     uint64
+	pageEnd uint64
+
+	next  rlepluslazy.Run
+	stash rlepluslazy.Run
+}
+
+func newPageIterator(pageSize uint64, pages []uint64, load func(page uint64) (rlepluslazy.RunIterator, error)) (rlepluslazy.RunIterator, error) {
+	it := &pageIterator{
+		pageSize: pageSize,
+		pages:    pages,
+		load:     load,
+	}
+	if err := it.prep(); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+func (it *pageIterator) HasNext() bool {
+	return it.next.Valid()
+}
+
+func (it *pageIterator) NextRun() (rlepluslazy.Run, error) {
+	out := it.next
+	return out, it.prep()
+}
+
+// raw returns the next run from the current page, or the gap before the next
+// page. It returns an invalid run once all pages have been consumed.
+func (it *pageIterator) raw() (rlepluslazy.Run, error) {
+	for {
+		if it.cur != nil && it.cur.HasNext() {
+			run, err := it.cur.NextRun()
+			if err != nil {
+				return rlepluslazy.Run{}, err
+			}
+			if !run.Valid() {
+				continue
+			}
+			if it.pageEnd-it.pos < run.Len {
+				return rlepluslazy.Run{}, xerrors.Errorf("run of length %d exceeds page bounds", run.Len)
+			}
+			it.pos += run.Len
+			return run, nil
+		}
+
+		if len(it.pages) == 0 {
+			return rlepluslazy.Run{}, nil
+		}
+		page := it.pages[0]
+		it.pages = it.pages[1:]
+
+		start := page * it.pageSize
+		if page != 0 && start/page != it.pageSize || start < it.pos {
+			return rlepluslazy.Run{}, xerrors.Errorf("page %d is out of range", page)
+		}
+		it.pageEnd = start + it.pageSize
+		if it.pageEnd < start {
+			// The last page may be truncated by the end of the index space.
+			it.pageEnd = math.MaxUint64
+		}
+
+		cur, err := it.load(page)
+		if err != nil {
+			return rlepluslazy.Run{}, xerrors.Errorf("loading page %d: %w", page, err)
+		}
+		it.cur = cur
+
+		if start > it.pos {
+			gap := rlepluslazy.Run{Val: false, Len: start - it.pos}
+			it.pos = start
+			return gap, nil
+		}
+	}
+}
+
+func (it *pageIterator) prep() error {
+	it.next, it.stash = it.stash, rlepluslazy.Run{}
+	if !it.next.Valid() {
+		var err error
+		it.next, err = it.raw()
+		if err != nil {
+			return err
+		}
+	}
+
+	for it.next.Valid() {
+		run, err := it.raw()
+		if err != nil {
+			return err
+		}
+		if !run.Valid() {
+			break
+		}
+		if run.Val != it.next.Val {
+			it.stash = run
+			break
+		}
+		it.next.Len += run.Len
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package bitfield
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pagedAll(t *testing.T, pb PagedBitField) []uint64 {
+	iter, err := pb.RunIterator()
+	require.NoError(t, err)
+	bits, err := rlepluslazy.SliceFromRuns(iter)
+	require.NoError(t, err)
+	return bits
+}
+
+func TestPagedRoundTrip(t *testing.T) {
+	for _, pageSize := range []uint64{1, 3, 64, 1000, 1 << 20} {
+		for i := int64(0); i < 10; i++ {
+			t.Run(fmt.Sprintf("%d-%d", pageSize, i), func(t *testing.T) {
+				set := getRandIndexSetSeed(2000, i)
+				iter, err := rlepluslazy.RunsFromSlice(set)
+				require.NoError(t, err)
+
+				pb, err := NewPagedFromIter(pageSize, iter)
+				require.NoError(t, err)
+
+				assert.Equal(t, set, pagedAll(t, pb))
+
+				count, err := pb.Count()
+				require.NoError(t, err)
+				assert.EqualValues(t, len(set), count)
+
+				for _, b := range []uint64{0, 1, 500, 1999, 2000} {
+					isSet, err := pb.IsSet(b)
+					require.NoError(t, err)
+					expected, err := NewFromSet(set).IsSet(b)
+					require.NoError(t, err)
+					assert.Equal(t, expected, isSet, "bit %d", b)
+				}
+			})
+		}
+	}
+}
+
+func TestPagedJoinsRunsAcrossPages(t *testing.T) {
+	iter := &rlepluslazy.RunSliceIterator{Runs: []rlepluslazy.Run{
+		{Val: false, Len: 5},
+		{Val: true, Len: 100},
+	}}
+	pb, err := NewPagedFromIter(10, iter)
+	require.NoError(t, err)
+	assert.Equal(t, 11, pb.NumPages())
+
+	out, err := pb.RunIterator()
+	require.NoError(t, err)
+
+	var runs []rlepluslazy.Run
+	for out.HasNext() {
+		r, err := out.NextRun()
+		require.NoError(t, err)
+		runs = append(runs, r)
+	}
+	assert.Equal(t, []rlepluslazy.Run{{Val: false, Len: 5}, {Val: true, Len: 100}}, runs)
+}
+
+func TestPagedSetUnset(t *testing.T) {
+	pb := NewPaged(16)
+
+	require.NoError(t, pb.Set(3))
+	require.NoError(t, pb.Set(40))
+	require.NoError(t, pb.Set(math.MaxUint64-1))
+	assert.Equal(t, []uint64{3, 40, math.MaxUint64 - 1}, pagedAll(t, pb))
+	assert.Equal(t, 3, pb.NumPages())
+
+	require.NoError(t, pb.Unset(40))
+	require.NoError(t, pb.Unset(41))
+	assert.Equal(t, []uint64{3, math.MaxUint64 - 1}, pagedAll(t, pb))
+	assert.Equal(t, 2, pb.NumPages())
+}
+
+func TestPagedCombinators(t *testing.T) {
+	a := getRandIndexSetSeed(1000, 1)
+	b := getRandIndexSetSeed(1000, 2)
+
+	ia, err := rlepluslazy.RunsFromSlice(a)
+	require.NoError(t, err)
+	pa, err := NewPagedFromIter(37, ia)
+	require.NoError(t, err)
+
+	ib, err := rlepluslazy.RunsFromSlice(b)
+	require.NoError(t, err)
+	pb, err := NewPagedFromIter(100, ib)
+	require.NoError(t, err)
+
+	ra, err := pa.RunIterator()
+	require.NoError(t, err)
+	rb, err := pb.RunIterator()
+	require.NoError(t, err)
+	and, err := rlepluslazy.And(ra, rb)
+	require.NoError(t, err)
+	bf, err := NewFromIter(and)
+	require.NoError(t, err)
+
+	bits, err := bf.All(1000)
+	require.NoError(t, err)
+	assert.Equal(t, setIntersect(a, b), bits)
+}
+
+func TestPagedInvalidPageSize(t *testing.T) {
+	_, err := NewPagedFromIter(0, &rlepluslazy.RunSliceIterator{})
+	assert.Equal(t, ErrInvalidPageSize, err)
+
+	assert.Panics(t, func() { NewPaged(0) })
+
+	// The zero value is empty, but has no page size to set bits with.
+	var pb PagedBitField
+	_, err = pb.IsSet(1)
+	assert.Equal(t, ErrInvalidPageSize, err)
+	assert.Equal(t, ErrInvalidPageSize, pb.Set(1))
+	assert.Equal(t, ErrInvalidPageSize, pb.Unset(1))
+
+	count, err := pb.Count()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), count)
+	iter, err := pb.RunIterator()
+	require.NoError(t, err)
+	assert.False(t, iter.HasNext())
+}
@@ -0,0 +1,62 @@
+package bitfield
+
+import "sync"
+
+// MultiMergeParallel returns the union of all the passed BitFields, like
+// MultiMerge, using up to workers goroutines. The BitFields are split into
+// consecutive groups that are merged concurrently, and the results are then
+// merged together.
+//
+// The result is identical to MultiMerge.
+func MultiMergeParallel(workers int, bfs ...BitField) (BitField, error) {
+	return parallelReduce(workers, bfs, MultiMerge)
+}
+
+// MultiIntersectParallel returns the intersection of all the passed BitFields,
+// like MultiIntersect, using up to workers goroutines.
+//
+// The result is identical to MultiIntersect.
+func MultiIntersectParallel(workers int, bfs ...BitField) (BitField, error) {
+	return parallelReduce(workers, bfs, MultiIntersect)
+}
+
+// parallelReduce splits bfs into up to workers groups of at least two
+// bitfields, reduces each group in its own goroutine, and then reduces the
+// results. reduce must be associative.
+func parallelReduce(workers int, bfs []BitField, reduce func(...BitField) (BitField, error)) (BitField, error) {
+	groupSize := 2
+	if workers > 0 && (len(bfs)+workers-1)/workers > groupSize {
+		groupSize = (len(bfs) + workers - 1) / workers
+	}
+	groups := (len(bfs) + groupSize - 1) / groupSize
+	if workers <= 1 || groups <= 1 {
+		return reduce(bfs...)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		results = make([]BitField, groups)
+		errs    = make([]error, groups)
+	)
+	for i := 0; i < groups; i++ {
+		start, end := i*groupSize, (i+1)*groupSize
+		if end > len(bfs) {
+			end = len(bfs)
+		}
+
+		wg.Add(1)
+		go func(i int, group []BitField) {
+			defer wg.Done()
+			results[i], errs[i] = reduce(group...)
+		}(i, bfs[start:end])
+	}
+	wg.Wait()
+
+	// Return the first error, so the result doesn't depend on scheduling.
+	for _, err := range errs {
+		if err != nil {
+			return BitField{}, err
+		}
+	}
+	return reduce(results...)
+}
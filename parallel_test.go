@@ -0,0 +1,123 @@
+package bitfield
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func marshalBytes(t testing.TB, bf BitField) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, bf.MarshalCBOR(&buf))
+	return buf.Bytes()
+}
+
+// denseBitFields returns bitfields with most bits below universe set, so their
+// intersections aren't empty.
+func denseBitFields(n int, universe uint64) []BitField {
+	r := rand.New(rand.NewSource(int64(n)))
+	bfs := make([]BitField, n)
+	for i := range bfs {
+		var set []uint64
+		for b := uint64(0); b < universe; b++ {
+			if r.Intn(50) != 0 {
+				set = append(set, b)
+			}
+		}
+		bfs[i] = NewFromSet(set)
+	}
+	return bfs
+}
+
+func TestMultiMergeParallel(t *testing.T) {
+	var bfs []BitField
+	for i := 0; i < 100; i++ {
+		bfs = append(bfs, NewFromSet(getRandIndexSetSeed(100*(i+1), int64(i))))
+	}
+
+	for _, workers := range []int{0, 1, 2, 3, 8, 64, 200} {
+		for _, n := range []int{0, 1, 2, 5, 100} {
+			expected, err := MultiMerge(bfs[:n]...)
+			require.NoError(t, err)
+			res, err := MultiMergeParallel(workers, bfs[:n]...)
+			require.NoError(t, err)
+			assert.Equal(t, marshalBytes(t, expected), marshalBytes(t, res), "workers %d, n %d", workers, n)
+		}
+	}
+}
+
+func TestMultiIntersectParallel(t *testing.T) {
+	bfs := denseBitFields(20, 2000)
+
+	expected := make(map[uint64]bool)
+	for i, bf := range bfs {
+		bits, err := bf.AllMap(2000)
+		require.NoError(t, err)
+		if i == 0 {
+			expected = bits
+			continue
+		}
+		for b := range expected {
+			if !bits[b] {
+				delete(expected, b)
+			}
+		}
+	}
+	require.NotEmpty(t, expected)
+
+	seq, err := MultiIntersect(bfs...)
+	require.NoError(t, err)
+	bits, err := seq.AllMap(2000)
+	require.NoError(t, err)
+	assert.Equal(t, expected, bits)
+
+	for _, workers := range []int{0, 1, 2, 3, 8, 64} {
+		for _, n := range []int{0, 1, 2, 5, 20} {
+			expected, err := MultiIntersect(bfs[:n]...)
+			require.NoError(t, err)
+			res, err := MultiIntersectParallel(workers, bfs[:n]...)
+			require.NoError(t, err)
+			assert.Equal(t, marshalBytes(t, expected), marshalBytes(t, res), "workers %d, n %d", workers, n)
+		}
+	}
+}
+
+func TestParallelError(t *testing.T) {
+	invalid, err := NewFromBytes([]byte{0x0c, 0x00})
+	require.NoError(t, err)
+
+	bfs := denseBitFields(10, 100)
+	bfs[7] = invalid
+
+	_, err = MultiMergeParallel(4, bfs...)
+	assert.Error(t, err)
+	_, err = MultiIntersectParallel(4, bfs...)
+	assert.Error(t, err)
+}
+
+func BenchmarkMultiMergeParallel(b *testing.B) {
+	var bfs []BitField
+	for i := 0; i < 400; i++ {
+		bf, err := NewFromSet(getRandIndexSetSeed(2000, int64(i))).Copy()
+		require.NoError(b, err)
+		bfs = append(bfs, bf)
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := MultiMerge(bfs...); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := MultiMergeParallel(8, bfs...); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -193,3 +193,10 @@ func RunsFromBits(source BitIterator) (RunIterator, error) {
 func RunsFromSlice(slice []uint64) (RunIterator, error) {
 	return RunsFromBits(BitsFromSlice(slice))
 }
+
+// RunsFromSortedSlice is like RunsFromSlice, but slice must already be sorted in
+// ascending order, without duplicates. It isn't modified, so it can be iterated
+// over repeatedly without sorting it again.
+func RunsFromSortedSlice(slice []uint64) (RunIterator, error) {
+	return RunsFromBits(&sliceIt{slice})
+}
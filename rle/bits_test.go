@@ -84,3 +84,18 @@ func testIter(t *testing.T, ctor func(t *testing.T, bits []uint64) BitIterator)
 		assert.Equal(t, ErrEndOfIterator, err)
 	}
 }
+
+func TestRunsFromSortedSlice(t *testing.T) {
+	bits := []uint64{1, 2, 3, 6, 7, 8}
+	for i := 0; i < 2; i++ {
+		rit, err := RunsFromSortedSlice(bits)
+		assert.NoError(t, err)
+		assert.Equal(t, []Run{
+			{Val: false, Len: 1},
+			{Val: true, Len: 3},
+			{Val: false, Len: 2},
+			{Val: true, Len: 3},
+		}, collectRuns(t, rit))
+	}
+	assert.Equal(t, []uint64{1, 2, 3, 6, 7, 8}, bits)
+}
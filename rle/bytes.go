@@ -0,0 +1,79 @@
+package rlepluslazy
+
+import (
+	"math/bits"
+
+	"github.com/filecoin-project/go-bitfield/rle/internal/rleplus"
+)
+
+// BitNumbering indicates the ordering of bits within each byte of a bitmap,
+// either least-significant bit in position 0, or most-significant bit in
+// position 0. It's the same type used by the rleplus bit vectors.
+type BitNumbering = rleplus.BitNumbering
+
+const (
+	// LSB0 - bit ordering starts with the low-order bit
+	LSB0 = rleplus.LSB0
+
+	// MSB0 - bit ordering starts with the high-order bit
+	MSB0 = rleplus.MSB0
+)
+
+// RunsFromBytes returns an iterator over the runs of a dense bitmap, where bit
+// i is stored in byte i/8 of buf, at the position given by order.
+//
+// Bytes with all bits equal are skipped in one step, so the runtime is
+// O(number of runs + number of bytes).
+func RunsFromBytes(buf []byte, order BitNumbering) RunIterator {
+	return newDenseIterator(len(buf), 8, func(i uint64) uint64 {
+		if order == MSB0 {
+			return uint64(bits.Reverse8(buf[i]))
+		}
+		return uint64(buf[i])
+	})
+}
+
+// BytesFromRuns expands the runs into a dense bitmap of universe bits, where bit
+// i is stored in byte i/8 at the position given by order. It returns an error if
+// any set bit is at or beyond universe.
+func BytesFromRuns(it RunIterator, universe uint64, order BitNumbering) ([]byte, error) {
+	buf := make([]byte, universe/8)
+	if universe%8 != 0 {
+		buf = append(buf, 0)
+	}
+
+	err := expandRuns(it, universe, func(start, end uint64) {
+		setByteRange(buf, start, end, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// setByteRange sets the bits [start, end) in buf.
+func setByteRange(buf []byte, start, end uint64, order BitNumbering) {
+	for start < end {
+		i, off := start/8, start%8
+		if off == 0 && end-start >= 8 {
+			// Fill whole bytes at once.
+			n := (end - start) / 8
+			for j := i; j < i+n; j++ {
+				buf[j] = 0xff
+			}
+			start += n * 8
+			continue
+		}
+
+		n := 8 - off
+		if end-start < n {
+			n = end - start
+		}
+		mask := byte(0xff>>(8-n)) << off
+		if order == MSB0 {
+			mask = bits.Reverse8(mask)
+		}
+		buf[i] |= mask
+		start += n
+	}
+}
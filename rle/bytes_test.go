@@ -0,0 +1,68 @@
+package rlepluslazy
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBytesRoundTrip(t *testing.T) {
+	for _, order := range []BitNumbering{LSB0, MSB0} {
+		for i := int64(0); i < 50; i++ {
+			r := rand.New(rand.NewSource(i))
+			universe := uint64(r.Intn(500))
+
+			var set []uint64
+			for b := uint64(0); b < universe; b++ {
+				if r.Intn(3) != 0 {
+					set = append(set, b)
+				}
+			}
+
+			runs, err := RunsFromSlice(set)
+			require.NoError(t, err)
+			buf, err := BytesFromRuns(runs, universe, order)
+			require.NoError(t, err)
+			assert.Len(t, buf, int((universe+7)/8))
+
+			out, err := SliceFromRuns(RunsFromBytes(buf, order))
+			require.NoError(t, err)
+			assert.Equal(t, set, out)
+		}
+	}
+}
+
+func TestBytesBitOrder(t *testing.T) {
+	runs, err := RunsFromSlice([]uint64{0, 9, 10, 11, 12, 13, 14, 15, 16})
+	require.NoError(t, err)
+	buf, err := BytesFromRuns(runs, 24, LSB0)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0xfe, 0x01}, buf)
+
+	runs, err = RunsFromSlice([]uint64{0, 9, 10, 11, 12, 13, 14, 15, 16})
+	require.NoError(t, err)
+	buf, err = BytesFromRuns(runs, 24, MSB0)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x80, 0x7f, 0x80}, buf)
+
+	bits, err := SliceFromRuns(RunsFromBytes([]byte{0x80, 0x7f, 0x80}, MSB0))
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{0, 9, 10, 11, 12, 13, 14, 15, 16}, bits)
+}
+
+func TestBytesFromRunsOutOfUniverse(t *testing.T) {
+	runs, err := RunsFromSlice([]uint64{3, 8})
+	require.NoError(t, err)
+	_, err = BytesFromRuns(runs, 8, LSB0)
+	assert.Error(t, err)
+}
+
+func TestRunsFromBytesFullBytes(t *testing.T) {
+	for _, order := range []BitNumbering{LSB0, MSB0} {
+		buf := []byte{0x00, 0xff, 0xff, 0x00, 0xff}
+		runs := collectRuns(t, RunsFromBytes(buf, order))
+		assert.Equal(t, []Run{{Val: false, Len: 8}, {Val: true, Len: 16}, {Val: false, Len: 8}, {Val: true, Len: 8}}, runs)
+	}
+}
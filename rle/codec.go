@@ -0,0 +1,88 @@
+package rlepluslazy
+
+import (
+	"fmt"
+
+	"golang.org/x/xerrors"
+)
+
+// MaxVersion is the largest version that fits in the two version bits of the
+// RLE+ header.
+const MaxVersion = 3
+
+// Codec encodes and decodes runs for a single version of the RLE+ format. The
+// version is stored in the two low bits of the first byte, and each Codec is
+// responsible for writing and checking its own version bits.
+type Codec interface {
+	// Decode returns an iterator over the runs encoded in buf.
+	Decode(buf []byte) (RunIterator, error)
+	// Validate checks that buf is well formed and that its runs don't
+	// overflow uint64.
+	Validate(buf []byte) error
+	// Encode encodes the runs, reusing buf's storage if possible.
+	Encode(rit RunIterator, buf []byte) ([]byte, error)
+}
+
+var codecs [MaxVersion + 1]Codec
+
+func init() {
+	RegisterCodec(Version, v0Codec{})
+}
+
+// RegisterCodec registers the codec used to decode and encode the given RLE+
+// version. It panics if the version is out of range or already has a codec.
+//
+// RegisterCodec is not safe for concurrent use and should be called from an
+// init function.
+func RegisterCodec(version byte, c Codec) {
+	if version > MaxVersion {
+		panic(fmt.Sprintf("RLE+ version %d out of range", version))
+	}
+	if codecs[version] != nil {
+		panic(fmt.Sprintf("codec for RLE+ version %d already registered", version))
+	}
+	codecs[version] = c
+}
+
+// LookupCodec returns the codec registered for the given RLE+ version, or
+// ErrWrongVersion if there isn't one.
+func LookupCodec(version byte) (Codec, error) {
+	if version > MaxVersion || codecs[version] == nil {
+		return nil, ErrWrongVersion
+	}
+	return codecs[version], nil
+}
+
+// codecFor returns the codec for the version of the encoded buffer. Empty
+// buffers are decoded as the default version.
+func codecFor(buf []byte) (Codec, error) {
+	if len(buf) == 0 {
+		return codecs[Version], nil
+	}
+	return LookupCodec(buf[0] & MaxVersion)
+}
+
+// EncodeRunsVersion encodes the runs using the codec registered for version.
+// EncodeRuns always encodes using the default version.
+func EncodeRunsVersion(rit RunIterator, version byte, buf []byte) ([]byte, error) {
+	c, err := LookupCodec(version)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding RLE+ version %d: %w", version, err)
+	}
+	return c.Encode(rit, buf)
+}
+
+// v0Codec is the original RLE+ encoding.
+type v0Codec struct{}
+
+func (v0Codec) Decode(buf []byte) (RunIterator, error) {
+	return DecodeRLE(buf)
+}
+
+func (v0Codec) Validate(buf []byte) error {
+	return ValidateRLE(buf)
+}
+
+func (v0Codec) Encode(rit RunIterator, buf []byte) ([]byte, error) {
+	return EncodeRuns(rit, buf)
+}
@@ -0,0 +1,91 @@
+package rlepluslazy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+// v3TestCodec is the v0 encoding with different version bits.
+type v3TestCodec struct{}
+
+func (v3TestCodec) toV0(buf []byte) []byte {
+	out := append([]byte(nil), buf...)
+	out[0] &^= MaxVersion
+	return out
+}
+
+func (c v3TestCodec) Decode(buf []byte) (RunIterator, error) {
+	return DecodeRLE(c.toV0(buf))
+}
+
+func (c v3TestCodec) Validate(buf []byte) error {
+	return ValidateRLE(c.toV0(buf))
+}
+
+func (v3TestCodec) Encode(rit RunIterator, buf []byte) ([]byte, error) {
+	out, err := EncodeRuns(rit, buf)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		// We need at least one byte to hold the version.
+		out = append(out, 0)
+	}
+	out[0] |= 3
+	return out, nil
+}
+
+func withCodec(t *testing.T, version byte, c Codec) {
+	prev := codecs[version]
+	codecs[version] = nil
+	RegisterCodec(version, c)
+	t.Cleanup(func() { codecs[version] = prev })
+}
+
+func TestCodecRegistry(t *testing.T) {
+	bits := []uint64{0, 2, 4, 5, 6, 11, 12, 13, 100}
+
+	runs, err := RunsFromSlice(bits)
+	require.NoError(t, err)
+	_, err = EncodeRunsVersion(runs, 3, nil)
+	require.True(t, xerrors.Is(err, ErrWrongVersion))
+
+	withCodec(t, 3, v3TestCodec{})
+
+	runs, err = RunsFromSlice(bits)
+	require.NoError(t, err)
+	buf, err := EncodeRunsVersion(runs, 3, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, buf[0]&MaxVersion)
+
+	rle, err := FromBuf(buf)
+	require.NoError(t, err)
+	it, err := rle.RunIterator()
+	require.NoError(t, err)
+	out, err := SliceFromRuns(it)
+	require.NoError(t, err)
+	assert.Equal(t, bits, out)
+
+	// The default encoding is unchanged.
+	runs, err = RunsFromSlice(bits)
+	require.NoError(t, err)
+	buf, err = EncodeRuns(runs, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, Version, buf[0]&MaxVersion)
+}
+
+func TestCodecUnknownVersion(t *testing.T) {
+	_, err := FromBuf([]byte{0x02})
+	require.True(t, xerrors.Is(err, ErrWrongVersion))
+
+	_, err = LookupCodec(MaxVersion + 1)
+	require.Equal(t, ErrWrongVersion, err)
+}
+
+func TestRegisterCodecPanics(t *testing.T) {
+	assert.Panics(t, func() { RegisterCodec(Version, v0Codec{}) })
+	assert.Panics(t, func() { RegisterCodec(MaxVersion+1, v0Codec{}) })
+}
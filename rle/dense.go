@@ -0,0 +1,91 @@
+package rlepluslazy
+
+import (
+	"fmt"
+	"math/bits"
+
+	"golang.org/x/xerrors"
+)
+
+// denseIterator iterates over the runs of a dense bitmap stored as n chunks of
+// width bits, where bit i is bit i%width of get(i/width). Chunks with all bits
+// equal are skipped in one step.
+type denseIterator struct {
+	width uint64
+	mask  uint64 // the low width bits
+	get   func(i uint64) uint64
+
+	pos uint64
+	end uint64
+}
+
+func newDenseIterator(n int, width uint64, get func(i uint64) uint64) *denseIterator {
+	end := uint64(0)
+	for i := n - 1; i >= 0; i-- {
+		if c := get(uint64(i)); c != 0 {
+			end = uint64(i)*width + uint64(bits.Len64(c))
+			break
+		}
+	}
+	return &denseIterator{
+		width: width,
+		mask:  ^uint64(0) >> (64 - width),
+		get:   get,
+		end:   end,
+	}
+}
+
+func (it *denseIterator) HasNext() bool {
+	return it.pos < it.end
+}
+
+func (it *denseIterator) NextRun() (Run, error) {
+	if it.pos >= it.end {
+		return Run{}, fmt.Errorf("end of runs")
+	}
+
+	start := it.pos
+	val := it.get(start/it.width)&(1<<(start%it.width)) != 0
+	for it.pos < it.end {
+		c := it.get(it.pos / it.width)
+		if val {
+			c = ^c & it.mask
+		}
+		// Bits that differ from val, at or after pos.
+		c >>= it.pos % it.width
+		if c != 0 {
+			it.pos += uint64(bits.TrailingZeros64(c))
+			break
+		}
+		it.pos = (it.pos/it.width + 1) * it.width
+	}
+	if it.pos > it.end {
+		it.pos = it.end
+	}
+	return Run{Val: val, Len: it.pos - start}, nil
+}
+
+// expandRuns calls set for each run of set bits, as the range [start, end). It
+// returns an error if any set bit is at or beyond universe.
+func expandRuns(it RunIterator, universe uint64, set func(start, end uint64)) error {
+	var pos uint64
+	for it.HasNext() {
+		r, err := it.NextRun()
+		if err != nil {
+			return err
+		}
+		if universe-pos < r.Len {
+			if !r.Val {
+				// Any further set bits are out of range.
+				pos = universe
+				continue
+			}
+			return xerrors.Errorf("bitfield has set bits beyond universe %d", universe)
+		}
+		if r.Val {
+			set(pos, pos+r.Len)
+		}
+		pos += r.Len
+	}
+	return nil
+}
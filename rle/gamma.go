@@ -0,0 +1,224 @@
+package rlepluslazy
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+
+	"golang.org/x/xerrors"
+)
+
+// GammaVersion is the RLE+ version of the experimental Elias-gamma encoding.
+//
+// The encoding isn't registered by default. To decode it transparently with
+// RLE.RunIterator, call RegisterCodec(GammaVersion, GammaCodec{}).
+const GammaVersion = 1
+
+var ErrGammaDecode = errors.New("invalid encoding for Elias-gamma RLE+")
+
+// GammaCodec is an experimental Codec that stores each run length as an
+// Elias-gamma code: for a length N with k = floor(log2(N)), k zero bits followed
+// by the k+1 bits of N, most significant bit first. A run of 1 takes one bit,
+// like RLE+, while runs of 16-255 take 9-15 bits instead of 10-18.
+//
+// Like RLE+, the stream starts with two version bits and the value of the first
+// run, bits are packed starting with the least significant bit of each byte,
+// and trailing zero bytes are removed.
+type GammaCodec struct{}
+
+var _ Codec = GammaCodec{}
+
+func (GammaCodec) Decode(buf []byte) (RunIterator, error) {
+	return DecodeRLEGamma(buf)
+}
+
+func (GammaCodec) Validate(buf []byte) error {
+	return ValidateRLEGamma(buf)
+}
+
+func (GammaCodec) Encode(rit RunIterator, buf []byte) ([]byte, error) {
+	return EncodeRunsGamma(rit, buf)
+}
+
+// EncodeRunsGamma encodes the runs using the experimental Elias-gamma encoding.
+func EncodeRunsGamma(rit RunIterator, buf []byte) ([]byte, error) {
+	bv := writeBitvec(buf)
+	bv.Put(GammaVersion, 2)
+
+	first := true
+	prev := false
+
+	for rit.HasNext() {
+		run, err := rit.NextRun()
+		if err != nil {
+			return nil, err
+		}
+		if !rit.HasNext() && !run.Val {
+			break
+		}
+
+		if first {
+			if run.Val {
+				bv.Put(1, 1)
+			} else {
+				bv.Put(0, 1)
+			}
+			prev = run.Val
+			first = false
+		} else {
+			if prev == run.Val {
+				return nil, ErrSameValRuns
+			}
+			prev = run.Val
+		}
+
+		if run.Len == 0 {
+			return nil, xerrors.New("cannot encode a zero-length run")
+		}
+
+		k := byte(bits.Len64(run.Len) - 1)
+		for z := k; z > 0; {
+			n := z
+			if n > 8 {
+				n = 8
+			}
+			bv.Put(0, n)
+			z -= n
+		}
+
+		// Write the k+1 bits of the length, most significant bit first.
+		rev := bits.Reverse64(run.Len) >> (63 - k)
+		for n := int(k) + 1; n > 0; n -= 8 {
+			c := byte(8)
+			if n < 8 {
+				c = byte(n)
+			}
+			bv.Put(byte(rev)&(1<<c-1), c)
+			rev >>= 8
+		}
+	}
+
+	if first {
+		bv.Put(0, 1)
+	}
+
+	return bv.Out(), nil
+}
+
+// DecodeRLEGamma returns an iterator over runs encoded with EncodeRunsGamma.
+func DecodeRLEGamma(buf []byte) (RunIterator, error) {
+	r, err := newGammaReader(buf)
+	if err != nil {
+		return nil, err
+	}
+	it := &gammaIterator{r: r, lastVal: !r.firstVal}
+	if err := it.prep(); err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// ValidateRLEGamma validates that buf is a minimally encoded Elias-gamma RLE+
+// buffer whose runs don't overflow uint64.
+func ValidateRLEGamma(buf []byte) error {
+	r, err := newGammaReader(buf)
+	if err != nil {
+		return err
+	}
+
+	var total uint64
+	for {
+		runLen, err := r.next()
+		if err != nil {
+			return err
+		}
+		if runLen == 0 {
+			return nil
+		}
+		if math.MaxUint64-runLen < total {
+			return xerrors.Errorf("RLE+ overflow")
+		}
+		total += runLen
+	}
+}
+
+type gammaReader struct {
+	buf      []byte
+	pos      uint64 // bit position
+	firstVal bool
+}
+
+func newGammaReader(buf []byte) (*gammaReader, error) {
+	if len(buf) == 0 || buf[len(buf)-1] == 0 {
+		// trailing zeros bytes not allowed.
+		return nil, xerrors.Errorf("not minimally encoded: %w", ErrGammaDecode)
+	}
+	if buf[0]&MaxVersion != GammaVersion {
+		return nil, ErrWrongVersion
+	}
+	return &gammaReader{
+		buf:      buf,
+		pos:      3,
+		firstVal: buf[0]&4 != 0,
+	}, nil
+}
+
+// peek returns the next 64 bits of the stream, starting with the least
+// significant bit. Bits past the end of the buffer are zero.
+func (r *gammaReader) peek() uint64 {
+	i, shift := r.pos/8, r.pos%8
+	if i >= uint64(len(r.buf)) {
+		return 0
+	}
+
+	var word [9]byte
+	copy(word[:], r.buf[i:])
+	v := binary.LittleEndian.Uint64(word[:8]) >> shift
+	if shift > 0 {
+		v |= uint64(word[8]) << (64 - shift)
+	}
+	return v
+}
+
+// next returns the next run length, or 0 at the end of the stream. The low bits
+// of the final code may have been removed along with trailing zero bytes, so
+// bits past the end of the buffer are read as zeros.
+func (r *gammaReader) next() (uint64, error) {
+	v := r.peek()
+	if v == 0 {
+		if total := uint64(len(r.buf)) * 8; r.pos >= total || total-r.pos <= 64 {
+			// Only padding remains.
+			return 0, nil
+		}
+		return 0, xerrors.Errorf("run too long: %w", ErrGammaDecode)
+	}
+	k := uint64(bits.TrailingZeros64(v))
+	r.pos += k
+
+	runLen := bits.Reverse64(r.peek()) >> (63 - k)
+	r.pos += k + 1
+	return runLen, nil
+}
+
+type gammaIterator struct {
+	r       *gammaReader
+	length  uint64
+	lastVal bool
+}
+
+func (it *gammaIterator) HasNext() bool {
+	return it.length != 0
+}
+
+func (it *gammaIterator) NextRun() (Run, error) {
+	ret := Run{Len: it.length, Val: !it.lastVal}
+	it.lastVal = ret.Val
+	return ret, it.prep()
+}
+
+func (it *gammaIterator) prep() error {
+	var err error
+	it.length, err = it.r.next()
+	return err
+}
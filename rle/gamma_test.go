@@ -0,0 +1,198 @@
+package rlepluslazy
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func collectRuns(t testing.TB, it RunIterator) []Run {
+	var runs []Run
+	for it.HasNext() {
+		r, err := it.NextRun()
+		require.NoError(t, err)
+		runs = append(runs, r)
+	}
+	return runs
+}
+
+// sectorRuns generates runs resembling a sector bitfield: mostly contiguous
+// allocations with occasional faults and terminations.
+func sectorRuns(seed int64, n int) []Run {
+	r := rand.New(rand.NewSource(seed))
+	runs := make([]Run, 0, n)
+	for i := 0; i < n; i++ {
+		val := i%2 == 1
+		var l uint64
+		if val {
+			l = uint64(16 + r.Intn(240))
+		} else {
+			l = uint64(1 + r.Intn(20))
+		}
+		runs = append(runs, Run{Val: val, Len: l})
+	}
+	return runs
+}
+
+func TestGammaRoundTrip(t *testing.T) {
+	sets := map[string][]Run{
+		"empty":   nil,
+		"one":     {{Val: true, Len: 1}},
+		"zero":    {{Val: false, Len: 5}, {Val: true, Len: 3}},
+		"max":     {{Val: true, Len: math.MaxUint64}},
+		"sectors": sectorRuns(1, 1000),
+	}
+	for i := int64(0); i < 10; i++ {
+		sets[fmt.Sprintf("zipf-%d", i)] = collectRuns(t, NewFromZipfDist(i, 1000))
+	}
+
+	for name, runs := range sets {
+		t.Run(name, func(t *testing.T) {
+			buf, err := EncodeRunsGamma(&RunSliceIterator{Runs: runs}, nil)
+			require.NoError(t, err)
+			require.NoError(t, ValidateRLEGamma(buf))
+
+			it, err := DecodeRLEGamma(buf)
+			require.NoError(t, err)
+			out := collectRuns(t, it)
+
+			if len(runs) > 0 && !runs[len(runs)-1].Val {
+				runs = runs[:len(runs)-1]
+			}
+			assert.Equal(t, runs, out)
+		})
+	}
+}
+
+func TestGammaCodec(t *testing.T) {
+	withCodec(t, GammaVersion, GammaCodec{})
+
+	bits := []uint64{0, 2, 4, 5, 6, 11, 12, 13, 100, 1000, 1001}
+	runs, err := RunsFromSlice(bits)
+	require.NoError(t, err)
+	buf, err := EncodeRunsVersion(runs, GammaVersion, nil)
+	require.NoError(t, err)
+
+	rle, err := FromBuf(buf)
+	require.NoError(t, err)
+	it, err := rle.RunIterator()
+	require.NoError(t, err)
+	out, err := SliceFromRuns(it)
+	require.NoError(t, err)
+	assert.Equal(t, bits, out)
+}
+
+func TestGammaNotRegisteredByDefault(t *testing.T) {
+	buf, err := EncodeRunsGamma(&RunSliceIterator{Runs: []Run{{Val: true, Len: 3}}}, nil)
+	require.NoError(t, err)
+	_, err = FromBuf(buf)
+	assert.True(t, xerrors.Is(err, ErrWrongVersion))
+}
+
+func TestGammaInvalid(t *testing.T) {
+	buf, err := EncodeRunsGamma(&RunSliceIterator{Runs: sectorRuns(2, 100)}, nil)
+	require.NoError(t, err)
+
+	assert.Error(t, ValidateRLEGamma(append(buf, 0)))
+	assert.Error(t, ValidateRLEGamma([]byte{0x00}))
+	assert.Error(t, ValidateRLEGamma([]byte{0x05, 0, 0, 0, 0, 0, 0, 0, 0, 0x80}))
+
+	// Two runs of MaxUint64 overflow.
+	buf, err = EncodeRunsGamma(&RunSliceIterator{Runs: []Run{
+		{Val: true, Len: math.MaxUint64},
+		{Val: false, Len: math.MaxUint64},
+		{Val: true, Len: 1},
+	}}, nil)
+	require.NoError(t, err)
+	assert.Error(t, ValidateRLEGamma(buf))
+}
+
+type gammaDataset struct {
+	name string
+	runs []Run
+}
+
+func gammaDatasets(t testing.TB) []gammaDataset {
+	golden, err := DecodeRLE(goldenRLE)
+	require.NoError(t, err)
+
+	sets := []gammaDataset{
+		{"golden", collectRuns(t, golden)},
+		{"sectors", sectorRuns(1, 10000)},
+	}
+	for _, size := range []int{10, 1000, 100000} {
+		sets = append(sets, gammaDataset{
+			name: fmt.Sprintf("zipf-%d", size),
+			runs: collectRuns(t, NewFromZipfDist(55, size)),
+		})
+	}
+	return sets
+}
+
+// TestGammaSizeReport compares encoded sizes of RLE+ and the Elias-gamma
+// encoding. Run with -v to see the report.
+func TestGammaSizeReport(t *testing.T) {
+	for _, ds := range gammaDatasets(t) {
+		rle, err := EncodeRuns(&RunSliceIterator{Runs: ds.runs}, nil)
+		require.NoError(t, err)
+		gamma, err := EncodeRunsGamma(&RunSliceIterator{Runs: ds.runs}, nil)
+		require.NoError(t, err)
+
+		t.Logf("%-12s runs: %7d, rle+: %8d bytes, gamma: %8d bytes (%+.1f%%)",
+			ds.name, len(ds.runs), len(rle), len(gamma),
+			100*(float64(len(gamma))/float64(len(rle))-1))
+	}
+}
+
+func BenchmarkGammaCompare(b *testing.B) {
+	for _, ds := range gammaDatasets(b) {
+		rle, err := EncodeRuns(&RunSliceIterator{Runs: ds.runs}, nil)
+		require.NoError(b, err)
+		gamma, err := EncodeRunsGamma(&RunSliceIterator{Runs: ds.runs}, nil)
+		require.NoError(b, err)
+
+		b.Run(ds.name+"/encode/rle", func(b *testing.B) {
+			buf := make([]byte, 0, len(rle))
+			for i := 0; i < b.N; i++ {
+				if _, err := EncodeRuns(&RunSliceIterator{Runs: ds.runs}, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(ds.name+"/encode/gamma", func(b *testing.B) {
+			buf := make([]byte, 0, len(gamma))
+			for i := 0; i < b.N; i++ {
+				if _, err := EncodeRunsGamma(&RunSliceIterator{Runs: ds.runs}, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(ds.name+"/decode/rle", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				it, err := DecodeRLE(rle)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := Count(it); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(ds.name+"/decode/gamma", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				it, err := DecodeRLEGamma(gamma)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := Count(it); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
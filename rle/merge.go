@@ -29,3 +29,33 @@ func Union(iters ...RunIterator) (RunIterator, error) {
 
 	return iters[0], nil
 }
+
+// Intersection returns the intersection of the passed iterators, combining them
+// with a binary tree of Ands. The intersection of no iterators is empty.
+func Intersection(iters ...RunIterator) (RunIterator, error) {
+	if len(iters) == 0 {
+		return RunsFromSlice(nil)
+	}
+
+	for len(iters) > 1 {
+		var next []RunIterator
+
+		for i := 0; i < len(iters); i += 2 {
+			if i+1 >= len(iters) {
+				next = append(next, iters[i])
+				continue
+			}
+
+			andit, err := And(iters[i], iters[i+1])
+			if err != nil {
+				return nil, err
+			}
+
+			next = append(next, andit)
+		}
+
+		iters = next
+	}
+
+	return iters[0], nil
+}
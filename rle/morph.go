@@ -0,0 +1,112 @@
+package rlepluslazy
+
+import "math"
+
+// DropShort returns an iterator with the runs of ones shorter than minLen
+// unset. It's the lossy opposite of JoinClose.
+func DropShort(it RunIterator, minLen uint64) (RunIterator, error) {
+	return newIntervalIter(it, func(start, end uint64) (uint64, uint64, bool) {
+		return start, end, end-start >= minLen
+	})
+}
+
+// Erode returns an iterator with n bits unset at both ends of every run of
+// ones. Runs of 2n or fewer ones are removed.
+func Erode(it RunIterator, n uint64) (RunIterator, error) {
+	return newIntervalIter(it, func(start, end uint64) (uint64, uint64, bool) {
+		if l := end - start; l <= n || l-n <= n {
+			return 0, 0, false
+		}
+		return start + n, end - n, true
+	})
+}
+
+// Dilate returns an iterator with n bits set at both ends of every run of
+// ones, joining runs separated by 2n or fewer zeros.
+func Dilate(it RunIterator, n uint64) (RunIterator, error) {
+	return newIntervalIter(it, func(start, end uint64) (uint64, uint64, bool) {
+		start -= min(start, n)
+		if math.MaxUint64-end < n {
+			end = math.MaxUint64
+		} else {
+			end += n
+		}
+		return start, end, true
+	})
+}
+
+// intervalIter maps each run of ones, as the interval [start, end), to a new
+// interval, merging intervals that touch or overlap. The mapped intervals must
+// start in the same order as the runs.
+type intervalIter struct {
+	it RunIterator
+	f  func(start, end uint64) (uint64, uint64, bool)
+
+	pos uint64 // position in it
+	out uint64 // end of the last returned run
+
+	// The next interval to return, if ok.
+	start, end uint64
+	ok         bool
+}
+
+func newIntervalIter(it RunIterator, f func(start, end uint64) (uint64, uint64, bool)) (RunIterator, error) {
+	ii := &intervalIter{it: it, f: f}
+
+	var err error
+	ii.start, ii.end, ii.ok, err = ii.nextInterval()
+	if err != nil {
+		return nil, err
+	}
+	return ii, nil
+}
+
+// nextInterval returns the next mapped interval of the input.
+func (ii *intervalIter) nextInterval() (start, end uint64, ok bool, err error) {
+	for ii.it.HasNext() {
+		r, err := ii.it.NextRun()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		start := ii.pos
+		ii.pos += r.Len
+		if !r.Val {
+			continue
+		}
+		if start, end, ok := ii.f(start, ii.pos); ok && end > start {
+			return start, end, true, nil
+		}
+	}
+	return 0, 0, false, nil
+}
+
+func (ii *intervalIter) HasNext() bool {
+	return ii.ok
+}
+
+func (ii *intervalIter) NextRun() (Run, error) {
+	if ii.out < ii.start {
+		r := Run{Val: false, Len: ii.start - ii.out}
+		ii.out = ii.start
+		return r, nil
+	}
+
+	// Merge the following intervals that touch this one.
+	end := ii.end
+	for {
+		start, next, ok, err := ii.nextInterval()
+		if err != nil {
+			ii.ok = false
+			return Run{}, err
+		}
+		if !ok || start > end {
+			ii.start, ii.end, ii.ok = start, next, ok
+			break
+		}
+		end = max(end, next)
+	}
+
+	r := Run{Val: true, Len: end - ii.out}
+	ii.out = end
+	return r, nil
+}
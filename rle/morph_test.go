@@ -0,0 +1,151 @@
+package rlepluslazy
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMorph(t *testing.T) {
+	inBits := []uint64{0, 1, 4, 5, 6, 9, 14, 15, 16, 17, 18, 19}
+	var tests = []struct {
+		name     string
+		op       func(RunIterator) (RunIterator, error)
+		expected []uint64
+	}{
+		{"drop 0", func(it RunIterator) (RunIterator, error) { return DropShort(it, 0) }, inBits},
+		{"drop 2", func(it RunIterator) (RunIterator, error) { return DropShort(it, 2) }, []uint64{0, 1, 4, 5, 6, 14, 15, 16, 17, 18, 19}},
+		{"drop 3", func(it RunIterator) (RunIterator, error) { return DropShort(it, 3) }, []uint64{4, 5, 6, 14, 15, 16, 17, 18, 19}},
+		{"drop 7", func(it RunIterator) (RunIterator, error) { return DropShort(it, 7) }, []uint64{}},
+		{"erode 0", func(it RunIterator) (RunIterator, error) { return Erode(it, 0) }, inBits},
+		{"erode 1", func(it RunIterator) (RunIterator, error) { return Erode(it, 1) }, []uint64{5, 15, 16, 17, 18}},
+		{"erode 3", func(it RunIterator) (RunIterator, error) { return Erode(it, 3) }, []uint64{}},
+		{"dilate 0", func(it RunIterator) (RunIterator, error) { return Dilate(it, 0) }, inBits},
+		{"dilate 1", func(it RunIterator) (RunIterator, error) { return Dilate(it, 1) }, []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 13, 14, 15, 16, 17, 18, 19, 20}},
+		{"dilate 2", func(it RunIterator) (RunIterator, error) { return Dilate(it, 2) }, []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := RunsFromSlice(inBits)
+			require.NoError(t, err)
+			it, err := tt.op(a)
+			require.NoError(t, err)
+			bits, err := SliceFromRuns(it)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, bits)
+		})
+	}
+}
+
+// naiveMorph applies the operations on a dense set of bits.
+func naiveMorph(set map[uint64]bool, universe uint64, op string, n uint64) []uint64 {
+	// Find runs of ones.
+	type interval struct{ start, end uint64 }
+	var runs []interval
+	for b := uint64(0); b < universe; b++ {
+		if !set[b] {
+			continue
+		}
+		if len(runs) > 0 && runs[len(runs)-1].end == b {
+			runs[len(runs)-1].end++
+		} else {
+			runs = append(runs, interval{b, b + 1})
+		}
+	}
+
+	out := make(map[uint64]bool)
+	for _, r := range runs {
+		switch op {
+		case "drop":
+			if r.end-r.start >= n {
+				for b := r.start; b < r.end; b++ {
+					out[b] = true
+				}
+			}
+		case "erode":
+			for b := r.start + n; b+n < r.end; b++ {
+				out[b] = true
+			}
+		case "dilate":
+			start := uint64(0)
+			if r.start > n {
+				start = r.start - n
+			}
+			for b := start; b < r.end+n; b++ {
+				out[b] = true
+			}
+		}
+	}
+
+	var bits []uint64
+	for b := uint64(0); b < universe+n; b++ {
+		if out[b] {
+			bits = append(bits, b)
+		}
+	}
+	return bits
+}
+
+func TestMorphRandom(t *testing.T) {
+	ops := map[string]func(RunIterator, uint64) (RunIterator, error){
+		"drop":   DropShort,
+		"erode":  Erode,
+		"dilate": Dilate,
+	}
+	for i := int64(0); i < 50; i++ {
+		r := rand.New(rand.NewSource(i))
+		universe := uint64(200)
+		set := make(map[uint64]bool)
+		var bits []uint64
+		for b := uint64(0); b < universe; b++ {
+			if r.Intn(3) != 0 {
+				set[b] = true
+				bits = append(bits, b)
+			}
+		}
+		n := uint64(r.Intn(5))
+
+		for name, op := range ops {
+			it, err := RunsFromSlice(bits)
+			require.NoError(t, err)
+			it, err = op(it, n)
+			require.NoError(t, err)
+			runs := collectRuns(t, it)
+
+			// The runs must be in canonical form.
+			for j, run := range runs {
+				assert.True(t, run.Valid())
+				if j > 0 {
+					assert.NotEqual(t, runs[j-1].Val, run.Val)
+				}
+			}
+			if len(runs) > 0 {
+				assert.True(t, runs[len(runs)-1].Val)
+			}
+
+			out, err := SliceFromRuns(&RunSliceIterator{Runs: runs})
+			require.NoError(t, err)
+			expected := naiveMorph(set, universe, name, n)
+			if len(expected) == 0 {
+				assert.Empty(t, out, "%s %d", name, n)
+			} else {
+				assert.Equal(t, expected, out, "%s %d", name, n)
+			}
+		}
+	}
+}
+
+func TestDilateOverflow(t *testing.T) {
+	it, err := Dilate(&RunSliceIterator{Runs: []Run{
+		{Val: false, Len: math.MaxUint64 - 5},
+		{Val: true, Len: 2},
+	}}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []Run{
+		{Val: false, Len: math.MaxUint64 - 15},
+		{Val: true, Len: 15},
+	}, collectRuns(t, it))
+}
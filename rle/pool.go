@@ -0,0 +1,40 @@
+package rlepluslazy
+
+import (
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+var decoderPool = sync.Pool{
+	New: func() interface{} {
+		return new(Decoder)
+	},
+}
+
+// pooledDecoder returns a pooled decoder over the runs of the RLE. Decoding with
+// it doesn't allocate. It returns false if the RLE+ isn't in the default
+// version and must be decoded with RunIterator instead.
+//
+// The decoder must be returned with putDecoder.
+func (rle *RLE) pooledDecoder() (*Decoder, bool, error) {
+	if len(rle.buf) > 0 && rle.buf[0]&MaxVersion != Version {
+		return nil, false, nil
+	}
+	if err := rle.Validate(); err != nil {
+		return nil, false, xerrors.Errorf("validation failed: %w", err)
+	}
+
+	d := decoderPool.Get().(*Decoder)
+	if err := d.Reset(rle.buf); err != nil {
+		putDecoder(d)
+		return nil, false, xerrors.Errorf("decoding RLE: %w", err)
+	}
+	return d, true, nil
+}
+
+func putDecoder(d *Decoder) {
+	// Don't keep the buffer alive.
+	*d = Decoder{}
+	decoderPool.Put(d)
+}
@@ -0,0 +1,39 @@
+package rlepluslazy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPooledDecoder(t *testing.T) {
+	buf, err := EncodeRuns(NewFromZipfDist(9, 1000), nil)
+	require.NoError(t, err)
+	rle, err := FromBuf(buf)
+	require.NoError(t, err)
+
+	d, ok, err := rle.pooledDecoder()
+	require.NoError(t, err)
+	require.True(t, ok)
+	it, err := rle.RunIterator()
+	require.NoError(t, err)
+	assert.Equal(t, collectRuns(t, it), collectRuns(t, d))
+	putDecoder(d)
+
+	summary, err := rle.Summary()
+	require.NoError(t, err)
+	allocs := testing.AllocsPerRun(100, func() {
+		set, err := rle.IsSet(summary.Last)
+		if err != nil || !set {
+			t.Fatal(set, err)
+		}
+	})
+	assert.Zero(t, allocs)
+
+	// Invalid buffers aren't decoded with a pooled decoder.
+	invalid, err := FromBuf([]byte{0x0c, 0x00})
+	require.NoError(t, err)
+	_, _, err = invalid.pooledDecoder()
+	assert.Error(t, err)
+}
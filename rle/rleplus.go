@@ -1,13 +1,19 @@
 package rlepluslazy
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
 
 	"golang.org/x/xerrors"
 )
 
+// Version is the RLE+ version produced by EncodeRuns.
 const Version = 0
 
 var (
@@ -16,15 +22,38 @@ var (
 )
 
 type RLE struct {
-	buf       []byte
-	validated bool
+	buf []byte
+
+	// meta caches the validation result and summary of buf. It's shared by
+	// copies of the RLE and is nil for the zero value, which isn't cached.
+	meta *rleMeta
+}
+
+type rleMeta struct {
+	validateOnce sync.Once
+	validateErr  error
+
+	summaryOnce sync.Once
+	summary     Summary
+	summaryErr  error
+}
+
+// Summary describes the bits of an RLE+ bitfield.
+type Summary struct {
+	// Count is the number of set bits.
+	Count uint64
+	// First and Last are the first and last set bits, or zero if there are
+	// no set bits.
+	First, Last uint64
+	// Runs is the number of runs, including runs of unset bits.
+	Runs uint64
 }
 
 func FromBuf(buf []byte) (RLE, error) {
-	rle := RLE{buf: buf}
+	rle := RLE{buf: buf, meta: new(rleMeta)}
 
-	if len(buf) > 0 && buf[0]&3 != Version {
-		return RLE{}, xerrors.Errorf("could not create RLE+ for a buffer: %w", ErrWrongVersion)
+	if _, err := codecFor(buf); err != nil {
+		return RLE{}, xerrors.Errorf("could not create RLE+ for a buffer: %w", err)
 	}
 
 	return rle, nil
@@ -39,10 +68,22 @@ func (rle *RLE) Bytes() []byte {
 
 // Validate is a separate function to show up on profile for repeated decode evaluation
 func (rle *RLE) Validate() error {
-	if !rle.validated {
-		return ValidateRLE(rle.buf)
+	if rle.meta == nil {
+		return validate(rle.buf)
 	}
-	return nil
+	m := rle.meta
+	m.validateOnce.Do(func() {
+		m.validateErr = validate(rle.buf)
+	})
+	return m.validateErr
+}
+
+func validate(buf []byte) error {
+	c, err := codecFor(buf)
+	if err != nil {
+		return err
+	}
+	return c.Validate(buf)
 }
 
 func (rle *RLE) RunIterator() (RunIterator, error) {
@@ -51,7 +92,12 @@ func (rle *RLE) RunIterator() (RunIterator, error) {
 		return nil, xerrors.Errorf("validation failed: %w", err)
 	}
 
-	source, err := DecodeRLE(rle.buf)
+	c, err := codecFor(rle.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := c.Decode(rle.buf)
 	if err != nil {
 		return nil, xerrors.Errorf("decoding RLE: %w", err)
 	}
@@ -60,11 +106,83 @@ func (rle *RLE) RunIterator() (RunIterator, error) {
 }
 
 func (rle *RLE) Count() (uint64, error) {
-	it, err := rle.RunIterator()
+	s, err := rle.Summary()
 	if err != nil {
 		return 0, err
 	}
-	return Count(it)
+	return s.Count, nil
+}
+
+// Summary returns the number of set bits, the first and last set bits, and the
+// number of runs. It's computed on the first call and cached for later calls.
+func (rle *RLE) Summary() (Summary, error) {
+	if rle.meta == nil {
+		return rle.summarize()
+	}
+	m := rle.meta
+	m.summaryOnce.Do(func() {
+		m.summary, m.summaryErr = rle.summarize()
+	})
+	return m.summary, m.summaryErr
+}
+
+func (rle *RLE) summarize() (Summary, error) {
+	d, ok, err := rle.pooledDecoder()
+	if err != nil {
+		return Summary{}, err
+	}
+	if ok {
+		defer putDecoder(d)
+		return summarizeRuns(d)
+	}
+
+	it, err := rle.RunIterator()
+	if err != nil {
+		return Summary{}, err
+	}
+	return summarizeRuns(it)
+}
+
+func summarizeRuns(it RunIterator) (Summary, error) {
+	var (
+		s   Summary
+		pos uint64
+	)
+	for it.HasNext() {
+		r, err := it.NextRun()
+		if err != nil {
+			return Summary{}, err
+		}
+		if r.Val {
+			if s.Count == 0 {
+				s.First = pos
+			}
+			s.Count += r.Len
+			s.Last = pos + r.Len - 1
+		}
+		pos += r.Len
+		s.Runs++
+	}
+	return s, nil
+}
+
+// IsSet returns whether bit x is set. Unlike iterating with RunIterator, it
+// doesn't allocate.
+func (rle *RLE) IsSet(x uint64) (bool, error) {
+	d, ok, err := rle.pooledDecoder()
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		defer putDecoder(d)
+		return IsSet(d, x)
+	}
+
+	it, err := rle.RunIterator()
+	if err != nil {
+		return false, err
+	}
+	return IsSet(it, x)
 }
 
 // Encoded as an array of run-lengths, always starting with zeroes (absent values)
@@ -102,32 +220,98 @@ func (rle *RLE) MarshalJSON() ([]byte, error) {
 }
 
 func (rle *RLE) UnmarshalJSON(b []byte) error {
-	var buf []uint64
+	return rle.UnmarshalJSONLimited(b, 0)
+}
 
-	if err := json.Unmarshal(b, &buf); err != nil {
+// UnmarshalJSONLimited decodes runs in the format produced by MarshalJSON,
+// failing if the RLE+ encoding would exceed maxEncodedSize bytes. A
+// maxEncodedSize of zero or less disables the limit.
+//
+// Each run length must be a non-negative integer, only the first may be zero,
+// and the runs must not extend past the end of the uint64 index.
+func (rle *RLE) UnmarshalJSONLimited(b []byte, maxEncodedSize int) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err != nil {
 		return err
 	}
 
-	runs := []Run{}
-	val := false
-	for i, v := range buf {
-		if v == 0 {
-			if i != 0 {
-				return xerrors.New("Cannot have a zero-length run except at start")
-			}
-		} else {
-			runs = append(runs, Run{
-				Val: val,
-				Len: v,
-			})
+	var runs []Run
+	switch tok {
+	case nil:
+		// null decodes to an empty bitfield, like json.Unmarshal into a
+		// nil slice.
+	case json.Delim('['):
+		if runs, err = readJSONRuns(dec, maxEncodedSize); err != nil {
+			return err
 		}
-		val = !val
+	default:
+		return xerrors.Errorf("expected an array of run lengths, got %v", tok)
 	}
+	if _, err := dec.Token(); err != io.EOF {
+		return xerrors.New("unexpected data after run lengths")
+	}
+
 	enc, err := EncodeRuns(&RunSliceIterator{Runs: runs}, []byte{})
 	if err != nil {
 		return xerrors.Errorf("encoding runs: %w", err)
 	}
 	rle.buf = enc
+	rle.meta = new(rleMeta)
 
 	return nil
 }
+
+// readJSONRuns reads the run lengths of a JSON array, after its opening
+// bracket, up to and including the closing bracket.
+func readJSONRuns(dec *json.Decoder, maxEncodedSize int) ([]Run, error) {
+	var (
+		runs  []Run
+		sc    SizeCounter
+		total uint64
+		val   bool
+	)
+	for i := 0; dec.More(); i++ {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		num, ok := tok.(json.Number)
+		if !ok {
+			return nil, xerrors.Errorf("run %d: expected a run length, got %v", i, tok)
+		}
+		v, err := strconv.ParseUint(num.String(), 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("run %d: invalid run length %s: must be a non-negative integer less than 2^64", i, num)
+		}
+
+		if v == 0 {
+			if i != 0 {
+				return nil, xerrors.New("Cannot have a zero-length run except at start")
+			}
+		} else {
+			if math.MaxUint64-v < total {
+				return nil, xerrors.Errorf("run %d: runs overflow the uint64 index", i)
+			}
+			total += v
+
+			r := Run{Val: val, Len: v}
+			if maxEncodedSize > 0 {
+				if err := sc.Add(r); err != nil {
+					return nil, err
+				}
+				if sc.Size() > maxEncodedSize {
+					return nil, xerrors.Errorf("run %d: encoded bitfield would exceed %d bytes", i, maxEncodedSize)
+				}
+			}
+			runs = append(runs, r)
+		}
+		val = !val
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
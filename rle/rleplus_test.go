@@ -6,6 +6,7 @@ import (
 
 	"github.com/filecoin-project/go-bitfield/rle/internal/rleplus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDecode(t *testing.T) {
@@ -182,3 +183,159 @@ func BenchmarkDecodeEncode(b *testing.B) {
 	*/
 	Res = Res + r
 }
+
+func TestSummary(t *testing.T) {
+	for i := int64(0); i < 20; i++ {
+		runs := collectRuns(t, NewFromZipfDist(i, 1000))
+		buf, err := EncodeRuns(&RunSliceIterator{Runs: runs}, nil)
+		require.NoError(t, err)
+		rle, err := FromBuf(buf)
+		require.NoError(t, err)
+
+		bits, err := SliceFromRuns(&RunSliceIterator{Runs: runs})
+		require.NoError(t, err)
+
+		expected := Summary{Count: uint64(len(bits))}
+		if len(bits) > 0 {
+			expected.First = bits[0]
+			expected.Last = bits[len(bits)-1]
+		}
+		if len(runs) > 0 && !runs[len(runs)-1].Val {
+			runs = runs[:len(runs)-1]
+		}
+		expected.Runs = uint64(len(runs))
+
+		s, err := rle.Summary()
+		require.NoError(t, err)
+		assert.Equal(t, expected, s)
+
+		// Copies share the cache, and the zero value isn't cached.
+		cp := rle
+		s, err = cp.Summary()
+		require.NoError(t, err)
+		assert.Equal(t, expected, s)
+
+		s, err = (&RLE{buf: buf}).Summary()
+		require.NoError(t, err)
+		assert.Equal(t, expected, s)
+
+		for _, b := range bits[:5] {
+			set, err := rle.IsSet(b)
+			require.NoError(t, err)
+			assert.True(t, set)
+		}
+		set, err := rle.IsSet(expected.Last + 1)
+		require.NoError(t, err)
+		assert.False(t, set)
+	}
+
+	var empty RLE
+	s, err := empty.Summary()
+	require.NoError(t, err)
+	assert.Equal(t, Summary{}, s)
+}
+
+func TestSummaryInvalidated(t *testing.T) {
+	var rle RLE
+	require.NoError(t, rle.UnmarshalJSON([]byte("[0, 3, 2, 1]")))
+	s, err := rle.Summary()
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Count: 4, First: 0, Last: 5, Runs: 3}, s)
+
+	require.NoError(t, rle.UnmarshalJSON([]byte("[10, 2]")))
+	s, err = rle.Summary()
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Count: 2, First: 10, Last: 11, Runs: 2}, s)
+}
+
+func TestValidateCached(t *testing.T) {
+	rle, err := FromBuf([]byte{0x0c, 0x00})
+	require.NoError(t, err)
+	assert.Error(t, rle.Validate())
+	assert.Error(t, rle.Validate())
+	_, err = rle.Summary()
+	assert.Error(t, err)
+}
+
+func BenchmarkSummary(b *testing.B) {
+	buf, err := EncodeRuns(NewFromZipfDist(55, 10000), nil)
+	require.NoError(b, err)
+
+	b.Run("cached", func(b *testing.B) {
+		rle, err := FromBuf(buf)
+		require.NoError(b, err)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := rle.Count(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		rle := RLE{buf: buf}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := rle.Count(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestUnmarshalJSONValidation(t *testing.T) {
+	for _, tc := range []struct {
+		in  string
+		err bool
+	}{
+		{`[0]`, false},
+		{`[]`, false},
+		{`null`, false},
+		{` null `, false},
+		{`null null`, true},
+		{` [0, 3, 5, 2] `, false},
+		{`[18446744073709551615]`, false},
+		{`[0, 18446744073709551615]`, false},
+		{`[3, 0]`, true},
+		{`[-1]`, true},
+		{`[1.5]`, true},
+		{`[1e3]`, true},
+		{`[18446744073709551616]`, true},
+		{`[18446744073709551615, 1]`, true},
+		{`[0, 9223372036854775808, 9223372036854775808]`, true},
+		{`["1"]`, true},
+		{`[[1]]`, true},
+		{`{"a": 1}`, true},
+		{`[1, 2`, true},
+		{`[1] [2]`, true},
+	} {
+		var rle RLE
+		err := rle.UnmarshalJSON([]byte(tc.in))
+		if tc.err {
+			assert.Error(t, err, tc.in)
+		} else {
+			assert.NoError(t, err, tc.in)
+		}
+	}
+
+	var rle RLE
+	err := rle.UnmarshalJSON([]byte(`[0, 1, -4]`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "run 2")
+}
+
+func TestUnmarshalJSONLimited(t *testing.T) {
+	// Sparse bits, so the encoding grows with every run.
+	runs := "[0"
+	for i := 0; i < 100; i++ {
+		runs += ",1,20"
+	}
+	runs += "]"
+
+	var rle RLE
+	require.NoError(t, rle.UnmarshalJSON([]byte(runs)))
+	size := len(rle.Bytes())
+
+	require.NoError(t, rle.UnmarshalJSONLimited([]byte(runs), size))
+	assert.Equal(t, size, len(rle.Bytes()))
+	assert.Error(t, rle.UnmarshalJSONLimited([]byte(runs), size-1))
+}
@@ -39,20 +39,7 @@ func EncodeRuns(rit RunIterator, buf []byte) ([]byte, error) {
 			prev = run.Val
 		}
 
-		switch {
-		case run.Len == 1:
-			bv.Put(1, 1)
-		case run.Len < 16:
-			bv.Put(2, 2)
-			bv.Put(byte(run.Len), 4)
-		case run.Len >= 16:
-			bv.Put(0, 2)
-			numBytes := binary.PutUvarint(varBuf, run.Len)
-			for i := 0; i < numBytes; i++ {
-				bv.Put(varBuf[i], 8)
-			}
-		}
-
+		putRunLen(bv, varBuf, run.Len)
 	}
 
 	if first {
@@ -60,5 +47,22 @@ func EncodeRuns(rit RunIterator, buf []byte) ([]byte, error) {
 	}
 
 	return bv.Out(), nil
+}
 
+// putRunLen writes the code for a run of the given length. varBuf must have
+// room for a uvarint.
+func putRunLen(bv *wbitvec, varBuf []byte, length uint64) {
+	switch {
+	case length == 1:
+		bv.Put(1, 1)
+	case length < 16:
+		bv.Put(2, 2)
+		bv.Put(byte(length), 4)
+	default:
+		bv.Put(0, 2)
+		numBytes := binary.PutUvarint(varBuf, length)
+		for i := 0; i < numBytes; i++ {
+			bv.Put(varBuf[i], 8)
+		}
+	}
 }
@@ -0,0 +1,99 @@
+package rlepluslazy
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"golang.org/x/xerrors"
+)
+
+// EncodedSize returns the exact length of the buffer EncodeRuns would produce
+// for the runs, without encoding them.
+//
+// A run of length 1 takes 1 bit, a run shorter than 16 takes 6 bits, and
+// longer runs take 2 bits plus 8 bits per byte of their varint length.
+func EncodedSize(it RunIterator) (int, error) {
+	var sc SizeCounter
+	for it.HasNext() {
+		r, err := it.NextRun()
+		if err != nil {
+			return 0, err
+		}
+		if err := sc.Add(r); err != nil {
+			return 0, err
+		}
+	}
+	return sc.Size(), nil
+}
+
+// SizeCounter computes the RLE+ encoded size of a sequence of runs as they're
+// added. The zero value is ready to use and represents an empty bitfield.
+//
+// SizeCounter is a value type; copying it forks the count, which can be used to
+// check the size of a bitfield with extra runs without committing to them.
+type SizeCounter struct {
+	started bool
+	prev    bool
+
+	// bits is the number of bits written so far, and lastOne is one past the
+	// position of the last one-bit. Trailing zero bytes are removed when
+	// encoding, so lastOne determines the size.
+	bits    uint64
+	lastOne uint64
+
+	// zeros is a trailing run of zeros that has not been written yet, as
+	// EncodeRuns drops the last run if it is a run of zeros.
+	zeros uint64
+}
+
+// Add appends a run. Consecutive runs must alternate values.
+func (sc *SizeCounter) Add(r Run) error {
+	if !r.Valid() {
+		return xerrors.New("cannot encode a zero-length run")
+	}
+
+	if !sc.started {
+		sc.started = true
+		sc.bits = 3 // version and the value of the first run
+		if r.Val {
+			sc.lastOne = 3
+		}
+	} else if sc.prev == r.Val {
+		return ErrSameValRuns
+	}
+	sc.prev = r.Val
+
+	if !r.Val {
+		sc.zeros = r.Len
+		return nil
+	}
+
+	if sc.zeros != 0 {
+		sc.put(sc.zeros)
+		sc.zeros = 0
+	}
+	sc.put(r.Len)
+	return nil
+}
+
+func (sc *SizeCounter) put(length uint64) {
+	p := sc.bits
+	switch {
+	case length == 1:
+		sc.bits += 1
+		sc.lastOne = p + 1
+	case length < 16:
+		sc.bits += 6
+		sc.lastOne = p + 2 + uint64(bits.Len64(length))
+	default:
+		var varBuf [binary.MaxVarintLen64]byte
+		n := uint64(binary.PutUvarint(varBuf[:], length))
+		sc.bits += 2 + 8*n
+		sc.lastOne = p + 2 + 8*(n-1) + uint64(bits.Len8(varBuf[n-1]))
+	}
+}
+
+// Size returns the encoded size in bytes of the runs added so far.
+func (sc *SizeCounter) Size() int {
+	return int((sc.lastOne + 7) / 8)
+}
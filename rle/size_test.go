@@ -0,0 +1,88 @@
+package rlepluslazy
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodedSize(t *testing.T) {
+	sets := map[string][]Run{
+		"empty":         nil,
+		"zeros":         {{Val: false, Len: 100}},
+		"one":           {{Val: true, Len: 1}},
+		"short":         {{Val: false, Len: 3}, {Val: true, Len: 15}},
+		"varint":        {{Val: true, Len: 16}, {Val: false, Len: 200}, {Val: true, Len: 1 << 20}},
+		"trailing-zero": {{Val: true, Len: 7}, {Val: false, Len: 1 << 30}},
+		"max":           {{Val: true, Len: math.MaxUint64}},
+		"sectors":       sectorRuns(3, 5000),
+	}
+	golden, err := DecodeRLE(goldenRLE)
+	require.NoError(t, err)
+	sets["golden"] = collectRuns(t, golden)
+
+	for name, runs := range sets {
+		t.Run(name, func(t *testing.T) {
+			buf, err := EncodeRuns(&RunSliceIterator{Runs: runs}, nil)
+			require.NoError(t, err)
+			size, err := EncodedSize(&RunSliceIterator{Runs: runs})
+			require.NoError(t, err)
+			assert.Equal(t, len(buf), size)
+		})
+	}
+
+	for i := int64(0); i < 100; i++ {
+		buf, err := EncodeRuns(NewFromZipfDist(i, 1000), nil)
+		require.NoError(t, err)
+		size, err := EncodedSize(NewFromZipfDist(i, 1000))
+		require.NoError(t, err)
+		assert.Equal(t, len(buf), size, "seed %d", i)
+	}
+}
+
+func TestEncodedSizeErrors(t *testing.T) {
+	_, err := EncodedSize(&RunSliceIterator{Runs: []Run{{Val: true, Len: 1}, {Val: true, Len: 1}}})
+	assert.Equal(t, ErrSameValRuns, err)
+
+	_, err = EncodedSize(&RunSliceIterator{Runs: []Run{{Val: true, Len: 0}}})
+	assert.Error(t, err)
+}
+
+func TestSizeCounterFork(t *testing.T) {
+	runs := sectorRuns(4, 100)
+
+	var sc SizeCounter
+	for i, r := range runs {
+		fork := sc
+		require.NoError(t, fork.Add(r))
+		require.NoError(t, sc.Add(r))
+		assert.Equal(t, sc.Size(), fork.Size())
+
+		buf, err := EncodeRuns(&RunSliceIterator{Runs: runs[:i+1]}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, len(buf), sc.Size())
+	}
+}
+
+func BenchmarkEncodedSize(b *testing.B) {
+	runs := collectRuns(b, NewFromZipfDist(55, 100000))
+	b.Run("encode", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, 1<<20)
+		for i := 0; i < b.N; i++ {
+			if _, err := EncodeRuns(&RunSliceIterator{Runs: runs}, buf); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("size", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := EncodedSize(&RunSliceIterator{Runs: runs}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
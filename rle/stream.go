@@ -0,0 +1,332 @@
+package rlepluslazy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"golang.org/x/xerrors"
+)
+
+// encoderFlushSize is the number of buffered bytes at which the Encoder writes
+// to the underlying writer.
+const encoderFlushSize = 512
+
+// Encoder writes RLE+ to an io.Writer as runs are added. The output is
+// identical to EncodeRuns, and only a small, fixed amount of it is buffered.
+type Encoder struct {
+	w  io.Writer
+	bv wbitvec
+
+	varBuf [binary.MaxVarintLen64]byte
+
+	started bool
+	prev    bool
+
+	// zeros is a pending run of zeros. It's written when the next run is
+	// added, as a trailing run of zeros isn't encoded.
+	zeros uint64
+
+	closed bool
+	err    error
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:  w,
+		bv: wbitvec{buf: make([]byte, 0, encoderFlushSize+binary.MaxVarintLen64)},
+	}
+}
+
+// WriteRun adds a run. Consecutive runs must alternate values.
+func (e *Encoder) WriteRun(r Run) error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.closed {
+		return xerrors.New("write to closed RLE+ encoder")
+	}
+	if !r.Valid() {
+		return xerrors.New("cannot encode a zero-length run")
+	}
+
+	if !e.started {
+		e.started = true
+		e.bv.Put(Version, 2)
+		if r.Val {
+			e.bv.Put(1, 1)
+		} else {
+			e.bv.Put(0, 1)
+		}
+	} else if e.prev == r.Val {
+		return ErrSameValRuns
+	}
+	e.prev = r.Val
+
+	if !r.Val {
+		e.zeros = r.Len
+		return nil
+	}
+
+	if e.zeros != 0 {
+		putRunLen(&e.bv, e.varBuf[:], e.zeros)
+		e.zeros = 0
+	}
+	putRunLen(&e.bv, e.varBuf[:], r.Len)
+
+	if len(e.bv.buf) >= encoderFlushSize {
+		e.err = e.flush()
+	}
+	return e.err
+}
+
+// flush writes the buffered bytes, holding back trailing zero bytes as they
+// are removed if nothing else is written after them.
+func (e *Encoder) flush() error {
+	n := len(e.bv.buf)
+	for n > 0 && e.bv.buf[n-1] == 0 {
+		n--
+	}
+	if n == 0 {
+		return nil
+	}
+	if _, err := e.w.Write(e.bv.buf[:n]); err != nil {
+		return err
+	}
+	e.bv.buf = e.bv.buf[:copy(e.bv.buf, e.bv.buf[n:])]
+	return nil
+}
+
+// Close writes any buffered data. It doesn't close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	out := e.bv.Out()
+	if len(out) == 0 {
+		return nil
+	}
+	if _, err := e.w.Write(out); err != nil {
+		e.err = err
+	}
+	return e.err
+}
+
+// Decoder is a RunIterator over RLE+ read from an io.Reader, one byte at a time,
+// or from a buffer. Only the default RLE+ version is supported.
+//
+// The reader must end with the encoded data, e.g. by wrapping it in an
+// io.LimitReader, as the Decoder reads it to the end to check that the data is
+// minimally encoded.
+//
+// The zero value is an empty iterator. Calling Reset with a buffer decodes it
+// without allocating, so a Decoder can be reused to iterate over many buffers.
+type Decoder struct {
+	br io.ByteReader
+
+	buf []byte
+	pos int
+
+	bits  uint32
+	nbits byte
+
+	read bool // whether any bytes were read
+	last byte // last byte read
+	eof  bool
+
+	length  uint64
+	lastVal bool
+	i       uint8
+	total   uint64
+
+	err error
+}
+
+var _ RunIterator = (*Decoder)(nil)
+
+// NewDecoder returns a Decoder reading from r. If r doesn't implement
+// io.ByteReader, it's wrapped in a bufio.Reader.
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	d := &Decoder{br: br}
+	if err := d.start(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reset discards the state of the decoder and makes it decode buf instead.
+func (d *Decoder) Reset(buf []byte) error {
+	*d = Decoder{buf: buf}
+	if len(buf) > 0 && buf[len(buf)-1] == 0 {
+		// trailing zeros bytes not allowed.
+		return xerrors.Errorf("not minimally encoded: %w", ErrDecode)
+	}
+	return d.start()
+}
+
+func (d *Decoder) start() error {
+	if d.get(2) != Version {
+		if d.err != nil {
+			return d.err
+		}
+		return ErrWrongVersion
+	}
+
+	// next run is previous in relation to prep
+	// so we invert the value
+	d.lastVal = d.get(1) != 1
+	return d.prep()
+}
+
+func (d *Decoder) HasNext() bool {
+	return d.length != 0
+}
+
+func (d *Decoder) NextRun() (r Run, err error) {
+	ret := Run{Len: d.length, Val: !d.lastVal}
+	d.lastVal = ret.Val
+
+	if d.i == 0 {
+		err = d.prep()
+	} else {
+		d.i--
+	}
+	return ret, err
+}
+
+func (d *Decoder) prep() error {
+	decode := decodeTable[d.peek6()]
+	d.get(decode.n)
+
+	d.i = decode.i
+	d.length = uint64(decode.length)
+	if decode.varint {
+		x, err := d.varint()
+		if err != nil {
+			d.length = 0
+			return err
+		}
+		d.length = x
+	}
+	if d.err != nil {
+		d.length = 0
+		return d.err
+	}
+
+	if d.length == 0 {
+		return d.finish()
+	}
+
+	runLen := uint64(d.i+1) * d.length
+	if math.MaxUint64-runLen < d.total {
+		d.length = 0
+		return xerrors.Errorf("RLE+ overflow")
+	}
+	d.total += runLen
+	return nil
+}
+
+// finish reads the rest of the input and checks that it doesn't end with a
+// zero byte.
+func (d *Decoder) finish() error {
+	if d.br == nil && d.pos < len(d.buf) {
+		d.pos = len(d.buf) - 1
+	}
+	for !d.eof {
+		d.readByte()
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if d.read && d.last == 0 {
+		// trailing zeros bytes not allowed.
+		return xerrors.Errorf("not minimally encoded: %w", ErrDecode)
+	}
+	return nil
+}
+
+func (d *Decoder) varint() (uint64, error) {
+	// Modified from the go standard library. Copyright the Go Authors and
+	// released under the BSD License.
+	var x uint64
+	var s uint
+	for i := 0; ; i++ {
+		if i == 10 {
+			return 0, xerrors.Errorf("run too long: %w", ErrDecode)
+		}
+		b := d.get(8)
+		if b < 0x80 {
+			if i == 9 && b > 1 {
+				return 0, xerrors.Errorf("run too long: %w", ErrDecode)
+			} else if b == 0 && s > 0 {
+				return 0, xerrors.Errorf("invalid run: %w", ErrDecode)
+			}
+			x |= uint64(b) << s
+			break
+		}
+		x |= uint64(b&0x7f) << s
+		s += 7
+	}
+	return x, nil
+}
+
+// readByte returns the next byte of the input, or zero past the end.
+func (d *Decoder) readByte() byte {
+	if d.eof {
+		return 0
+	}
+	if d.br == nil {
+		if d.pos == len(d.buf) {
+			d.eof = true
+			return 0
+		}
+		d.read = true
+		d.last = d.buf[d.pos]
+		d.pos++
+		return d.last
+	}
+
+	b, err := d.br.ReadByte()
+	if err != nil {
+		if err != io.EOF {
+			d.err = err
+		}
+		d.eof = true
+		return 0
+	}
+	d.read = true
+	d.last = b
+	return b
+}
+
+func (d *Decoder) fill(n byte) {
+	for d.nbits < n {
+		d.bits |= uint32(d.readByte()) << d.nbits
+		d.nbits += 8
+	}
+}
+
+func (d *Decoder) peek6() byte {
+	d.fill(6)
+	return byte(d.bits) & 0x3f
+}
+
+func (d *Decoder) get(n byte) byte {
+	d.fill(n)
+	res := byte(d.bits) & byte(1<<n-1)
+	d.bits >>= n
+	d.nbits -= n
+	return res
+}
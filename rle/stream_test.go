@@ -0,0 +1,223 @@
+package rlepluslazy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func streamDatasets(t testing.TB) map[string][]Run {
+	golden, err := DecodeRLE(goldenRLE)
+	require.NoError(t, err)
+
+	sets := map[string][]Run{
+		"empty":         nil,
+		"zeros":         {{Val: false, Len: 100}},
+		"one":           {{Val: true, Len: 1}},
+		"trailing-zero": {{Val: true, Len: 7}, {Val: false, Len: 1 << 30}},
+		"max":           {{Val: true, Len: math.MaxUint64}},
+		"golden":        collectRuns(t, golden),
+		"sectors":       sectorRuns(5, 20000),
+	}
+	for i := int64(0); i < 10; i++ {
+		sets[fmt.Sprintf("zipf-%d", i)] = collectRuns(t, NewFromZipfDist(i, 5000))
+	}
+	return sets
+}
+
+// chunkWriter records the size of each write.
+type chunkWriter struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func TestEncoder(t *testing.T) {
+	for name, runs := range streamDatasets(t) {
+		t.Run(name, func(t *testing.T) {
+			expected, err := EncodeRuns(&RunSliceIterator{Runs: runs}, nil)
+			require.NoError(t, err)
+
+			var w chunkWriter
+			enc := NewEncoder(&w)
+			for _, r := range runs {
+				require.NoError(t, enc.WriteRun(r))
+			}
+			require.NoError(t, enc.Close())
+			assert.Equal(t, len(expected), w.Len())
+			assert.True(t, bytes.Equal(expected, w.Bytes()))
+
+			for _, n := range w.writes {
+				assert.LessOrEqual(t, n, encoderFlushSize+binary.MaxVarintLen64)
+			}
+		})
+	}
+}
+
+func TestEncoderErrors(t *testing.T) {
+	enc := NewEncoder(new(bytes.Buffer))
+	require.NoError(t, enc.WriteRun(Run{Val: true, Len: 1}))
+	assert.Equal(t, ErrSameValRuns, enc.WriteRun(Run{Val: true, Len: 1}))
+	assert.Error(t, enc.WriteRun(Run{Val: false, Len: 0}))
+	require.NoError(t, enc.Close())
+	assert.Error(t, enc.WriteRun(Run{Val: false, Len: 1}))
+
+	errWrite := errors.New("write failed")
+	enc = NewEncoder(failWriter{errWrite})
+	var err error
+	for _, r := range sectorRuns(6, 10000) {
+		if err = enc.WriteRun(r); err != nil {
+			break
+		}
+	}
+	assert.Equal(t, errWrite, err)
+	assert.Equal(t, errWrite, enc.Close())
+}
+
+type failWriter struct{ err error }
+
+func (w failWriter) Write([]byte) (int, error) { return 0, w.err }
+
+// oneByteReader hides any io.ByteReader implementation of the wrapped reader.
+type oneByteReader struct{ r io.Reader }
+
+func (r oneByteReader) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return r.r.Read(p)
+}
+
+func TestDecoder(t *testing.T) {
+	for name, runs := range streamDatasets(t) {
+		t.Run(name, func(t *testing.T) {
+			buf, err := EncodeRuns(&RunSliceIterator{Runs: runs}, nil)
+			require.NoError(t, err)
+			it, err := DecodeRLE(buf)
+			require.NoError(t, err)
+			expected := collectRuns(t, it)
+
+			dec, err := NewDecoder(bytes.NewReader(buf))
+			require.NoError(t, err)
+			assert.Equal(t, expected, collectRuns(t, dec))
+
+			dec, err = NewDecoder(oneByteReader{bytes.NewReader(buf)})
+			require.NoError(t, err)
+			assert.Equal(t, expected, collectRuns(t, dec))
+		})
+	}
+}
+
+func TestDecoderInvalid(t *testing.T) {
+	buf, err := EncodeRuns(&RunSliceIterator{Runs: sectorRuns(7, 100)}, nil)
+	require.NoError(t, err)
+
+	decodeAll := func(buf []byte) error {
+		dec, err := NewDecoder(bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+		for dec.HasNext() {
+			if _, err := dec.NextRun(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err = decodeAll(append(buf, 0))
+	assert.True(t, xerrors.Is(err, ErrDecode))
+
+	assert.Equal(t, ErrWrongVersion, decodeAll([]byte{0x01}))
+
+	// Varint longer than 10 bytes.
+	err = decodeAll([]byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.True(t, xerrors.Is(err, ErrDecode))
+
+	// Two runs of MaxUint64 overflow.
+	buf, err = EncodeRuns(&RunSliceIterator{Runs: []Run{
+		{Val: true, Len: math.MaxUint64},
+		{Val: false, Len: math.MaxUint64},
+		{Val: true, Len: 1},
+	}}, nil)
+	require.NoError(t, err)
+	assert.Error(t, decodeAll(buf))
+
+	errRead := errors.New("read failed")
+	_, err = NewDecoder(io.MultiReader(bytes.NewReader([]byte{0x0c}), failReader{errRead}))
+	assert.Equal(t, errRead, err)
+}
+
+type failReader struct{ err error }
+
+func (r failReader) Read([]byte) (int, error) { return 0, r.err }
+
+func BenchmarkDecoder(b *testing.B) {
+	buf, err := EncodeRuns(NewFromZipfDist(55, 100000), nil)
+	require.NoError(b, err)
+
+	b.Run("slice", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			it, err := DecodeRLE(buf)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := Count(it); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			dec, err := NewDecoder(bytes.NewReader(buf))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := Count(dec); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestDecoderReset(t *testing.T) {
+	var d Decoder
+	assert.False(t, d.HasNext())
+
+	for name, runs := range streamDatasets(t) {
+		buf, err := EncodeRuns(&RunSliceIterator{Runs: runs}, nil)
+		require.NoError(t, err)
+		it, err := DecodeRLE(buf)
+		require.NoError(t, err)
+
+		require.NoError(t, d.Reset(buf))
+		assert.Equal(t, collectRuns(t, it), collectRuns(t, &d), name)
+	}
+
+	buf, err := EncodeRuns(NewFromZipfDist(8, 1000), nil)
+	require.NoError(t, err)
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := d.Reset(buf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Count(&d); err != nil {
+			t.Fatal(err)
+		}
+	})
+	assert.Zero(t, allocs)
+
+	assert.Error(t, d.Reset(append(buf, 0)))
+	assert.Equal(t, ErrWrongVersion, d.Reset([]byte{0x02}))
+}
@@ -0,0 +1,43 @@
+package rlepluslazy
+
+// RunsFromWords returns an iterator over the runs of a dense bitmap, where bit
+// i is stored in bit i%64 of words[i/64].
+//
+// This operation's runtime is O(number of runs + number of words), as runs are
+// found a word at a time.
+func RunsFromWords(words []uint64) RunIterator {
+	return newDenseIterator(len(words), 64, func(i uint64) uint64 {
+		return words[i]
+	})
+}
+
+// WordsFromRuns expands the runs into a dense bitmap of universe bits, where
+// bit i is stored in bit i%64 of words[i/64]. It returns an error if any set bit
+// is at or beyond universe.
+func WordsFromRuns(it RunIterator, universe uint64) ([]uint64, error) {
+	words := make([]uint64, universe/64)
+	if universe%64 != 0 {
+		words = append(words, 0)
+	}
+
+	err := expandRuns(it, universe, func(start, end uint64) {
+		setWordRange(words, start, end)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// setWordRange sets the bits [start, end) in words.
+func setWordRange(words []uint64, start, end uint64) {
+	for start < end {
+		w, off := start/64, start%64
+		n := 64 - off
+		if end-start < n {
+			n = end - start
+		}
+		words[w] |= (^uint64(0) >> (64 - n)) << off
+		start += n
+	}
+}
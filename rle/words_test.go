@@ -0,0 +1,163 @@
+package rlepluslazy
+
+import (
+	"math/bits"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWordsRoundTrip(t *testing.T) {
+	for i := int64(0); i < 100; i++ {
+		r := rand.New(rand.NewSource(i))
+		universe := uint64(r.Intn(1000))
+
+		var set []uint64
+		for b := uint64(0); b < universe; b++ {
+			if r.Intn(3) != 0 {
+				set = append(set, b)
+			}
+		}
+
+		runs, err := RunsFromSlice(set)
+		require.NoError(t, err)
+		words, err := WordsFromRuns(runs, universe)
+		require.NoError(t, err)
+		assert.Len(t, words, int((universe+63)/64))
+
+		out, err := SliceFromRuns(RunsFromWords(words))
+		require.NoError(t, err)
+		assert.Equal(t, set, out)
+	}
+}
+
+func TestRunsFromWords(t *testing.T) {
+	words := []uint64{0xffffffffffffffff, 0x1, 0x8000000000000000, 0, 0}
+	var runs []Run
+	it := RunsFromWords(words)
+	for it.HasNext() {
+		r, err := it.NextRun()
+		require.NoError(t, err)
+		runs = append(runs, r)
+	}
+	assert.Equal(t, []Run{
+		{Val: true, Len: 65},
+		{Val: false, Len: 126},
+		{Val: true, Len: 1},
+	}, runs)
+
+	assert.False(t, RunsFromWords(nil).HasNext())
+	assert.False(t, RunsFromWords([]uint64{0, 0}).HasNext())
+}
+
+func TestWordsFromRunsOutOfUniverse(t *testing.T) {
+	runs, err := RunsFromSlice([]uint64{1, 64})
+	require.NoError(t, err)
+	_, err = WordsFromRuns(runs, 64)
+	assert.Error(t, err)
+}
+
+// Roughly the number of sectors in a partition.
+const partitionSectors = 2349
+
+func partitionSet(seed int64) []uint64 {
+	r := rand.New(rand.NewSource(seed))
+	var set []uint64
+	for b := uint64(0); b < partitionSectors; b++ {
+		if r.Intn(4) != 0 {
+			set = append(set, b)
+		}
+	}
+	return set
+}
+
+func BenchmarkPartitionCount(b *testing.B) {
+	runs, err := RunsFromSlice(partitionSet(1))
+	require.NoError(b, err)
+	buf, err := EncodeRuns(runs, nil)
+	require.NoError(b, err)
+	runs, err = RunsFromSlice(partitionSet(1))
+	require.NoError(b, err)
+	words, err := WordsFromRuns(runs, partitionSectors)
+	require.NoError(b, err)
+
+	b.Run("rle", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			it, err := DecodeRLE(buf)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := Count(it); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("words", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := Count(RunsFromWords(words)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("popcount", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var count int
+			for _, w := range words {
+				count += bits.OnesCount64(w)
+			}
+			if count == 0 {
+				b.Fatal("expected bits to be set")
+			}
+		}
+	})
+}
+
+func BenchmarkPartitionOr(b *testing.B) {
+	var (
+		bufs  [2][]byte
+		words [2][]uint64
+	)
+	for i := range bufs {
+		runs, err := RunsFromSlice(partitionSet(int64(i)))
+		require.NoError(b, err)
+		bufs[i], err = EncodeRuns(runs, nil)
+		require.NoError(b, err)
+		runs, err = RunsFromSlice(partitionSet(int64(i)))
+		require.NoError(b, err)
+		words[i], err = WordsFromRuns(runs, partitionSectors)
+		require.NoError(b, err)
+	}
+
+	b.Run("rle", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			a, err := DecodeRLE(bufs[0])
+			if err != nil {
+				b.Fatal(err)
+			}
+			c, err := DecodeRLE(bufs[1])
+			if err != nil {
+				b.Fatal(err)
+			}
+			or, err := Or(a, c)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := EncodeRuns(or, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("words", func(b *testing.B) {
+		out := make([]uint64, len(words[0]))
+		for i := 0; i < b.N; i++ {
+			for j := range out {
+				out[j] = words[0][j] | words[1][j]
+			}
+			if _, err := EncodeRuns(RunsFromWords(out), nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
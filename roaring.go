@@ -0,0 +1,41 @@
+package bitfield
+
+import (
+	"github.com/filecoin-project/go-bitfield/roaring"
+	"golang.org/x/xerrors"
+)
+
+// NewFromRoaring decodes a bitfield serialized in the portable 64-bit roaring
+// bitmap format.
+func NewFromRoaring(buf []byte) (BitField, error) {
+	var rb roaring.Bitmap
+	if err := rb.UnmarshalBinary(buf); err != nil {
+		return BitField{}, xerrors.Errorf("could not decode roaring bitmap: %w", err)
+	}
+	iter, err := rb.RunIterator()
+	if err != nil {
+		return BitField{}, err
+	}
+	return NewFromIter(iter)
+}
+
+// ToRoaring converts the bitfield into a roaring bitmap.
+//
+// This operation's runtime is O(number of runs).
+func (bf BitField) ToRoaring() (*roaring.Bitmap, error) {
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return nil, err
+	}
+	return roaring.FromRuns(iter)
+}
+
+// MarshalRoaring serializes the bitfield in the portable 64-bit roaring bitmap
+// format.
+func (bf BitField) MarshalRoaring() ([]byte, error) {
+	rb, err := bf.ToRoaring()
+	if err != nil {
+		return nil, err
+	}
+	return rb.MarshalBinary()
+}
@@ -0,0 +1,171 @@
+package roaring
+
+import (
+	"math/bits"
+	"sort"
+)
+
+const (
+	// chunkBits is the number of low bits addressed within a single container.
+	chunkBits = 16
+	chunkSize = 1 << chunkBits
+
+	// maxArrayCardinality is the largest cardinality stored in an array
+	// container. Beyond this, a bitmap container is always smaller.
+	maxArrayCardinality = 4096
+
+	bitmapWords = chunkSize / 64
+)
+
+// interval is an inclusive range of set bits within a container.
+type interval struct {
+	start, last uint16
+}
+
+func (iv interval) length() int {
+	return int(iv.last) - int(iv.start) + 1
+}
+
+type container interface {
+	cardinality() int
+	contains(x uint16) bool
+	// intervals appends the ranges of set bits in the container to dst, in
+	// ascending order. Adjacent ranges are not necessarily joined.
+	intervals(dst []interval) []interval
+	// serializedSize is the number of bytes the container occupies when
+	// serialized, excluding headers.
+	serializedSize() int
+}
+
+type arrayContainer []uint16
+
+func (ac arrayContainer) cardinality() int {
+	return len(ac)
+}
+
+func (ac arrayContainer) contains(x uint16) bool {
+	i := sort.Search(len(ac), func(i int) bool { return ac[i] >= x })
+	return i < len(ac) && ac[i] == x
+}
+
+func (ac arrayContainer) intervals(dst []interval) []interval {
+	for i := 0; i < len(ac); {
+		j := i
+		for j+1 < len(ac) && ac[j+1] == ac[j]+1 {
+			j++
+		}
+		dst = append(dst, interval{start: ac[i], last: ac[j]})
+		i = j + 1
+	}
+	return dst
+}
+
+func (ac arrayContainer) serializedSize() int {
+	return 2 * len(ac)
+}
+
+type bitmapContainer struct {
+	words [bitmapWords]uint64
+	card  int
+}
+
+func (bc *bitmapContainer) cardinality() int {
+	return bc.card
+}
+
+func (bc *bitmapContainer) contains(x uint16) bool {
+	return bc.words[x/64]&(1<<(x%64)) != 0
+}
+
+func (bc *bitmapContainer) intervals(dst []interval) []interval {
+	for i, w := range bc.words {
+		base := uint16(i * 64)
+		for w != 0 {
+			start := bits.TrailingZeros64(w)
+			ones := bits.TrailingZeros64(^(w >> uint(start)))
+			dst = append(dst, interval{
+				start: base + uint16(start),
+				last:  base + uint16(start+ones-1),
+			})
+			if start+ones == 64 {
+				break
+			}
+			w &^= (1<<uint(ones) - 1) << uint(start)
+		}
+	}
+	return dst
+}
+
+func (bc *bitmapContainer) serializedSize() int {
+	return 8 * bitmapWords
+}
+
+type runContainer []interval
+
+func (rc runContainer) cardinality() int {
+	card := 0
+	for _, iv := range rc {
+		card += iv.length()
+	}
+	return card
+}
+
+func (rc runContainer) contains(x uint16) bool {
+	i := sort.Search(len(rc), func(i int) bool { return rc[i].last >= x })
+	return i < len(rc) && rc[i].start <= x
+}
+
+func (rc runContainer) intervals(dst []interval) []interval {
+	return append(dst, rc...)
+}
+
+func (rc runContainer) serializedSize() int {
+	return 2 + 4*len(rc)
+}
+
+// newContainer builds the smallest container holding the given sorted,
+// non-overlapping, non-adjacent intervals.
+func newContainer(ivs []interval) container {
+	card := 0
+	for _, iv := range ivs {
+		card += iv.length()
+	}
+
+	runSize := runContainer(ivs).serializedSize()
+	otherSize := 8 * bitmapWords
+	if card <= maxArrayCardinality {
+		otherSize = 2 * card
+	}
+
+	switch {
+	case runSize < otherSize:
+		return append(runContainer(nil), ivs...)
+	case card <= maxArrayCardinality:
+		ac := make(arrayContainer, 0, card)
+		for _, iv := range ivs {
+			for x := int(iv.start); x <= int(iv.last); x++ {
+				ac = append(ac, uint16(x))
+			}
+		}
+		return ac
+	default:
+		bc := &bitmapContainer{card: card}
+		for _, iv := range ivs {
+			setRange(&bc.words, int(iv.start), int(iv.last)+1)
+		}
+		return bc
+	}
+}
+
+// setRange sets the bits [start, end) in words.
+func setRange(words *[bitmapWords]uint64, start, end int) {
+	for start < end {
+		w, off := start/64, uint(start%64)
+		n := 64 - int(off)
+		if end-start < n {
+			n = end - start
+		}
+		words[w] |= (^uint64(0) >> uint(64-n)) << off
+		start += n
+	}
+}
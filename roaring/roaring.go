@@ -0,0 +1,188 @@
+// Package roaring implements a roaring-style bitmap over the uint64 index space
+// and conversion to and from RLE+ runs.
+//
+// RLE+ is compact for long runs but wasteful for random sparse sets. A roaring
+// bitmap instead splits the index space into chunks of 2^16 bits and stores each
+// chunk in whichever of an array, bitmap or run container is smallest.
+package roaring
+
+import (
+	"math"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+	"golang.org/x/xerrors"
+)
+
+// Bitmap is a roaring-style bitmap. The zero value is an empty bitmap.
+type Bitmap struct {
+	// keys are the high 48 bits of the indices in each container, in
+	// ascending order.
+	keys       []uint64
+	containers []container
+}
+
+// FromRuns constructs a Bitmap from the RunIterator, picking the cheapest
+// container for each chunk.
+//
+// This operation's runtime is O(number of runs + number of chunks).
+func FromRuns(it rlepluslazy.RunIterator) (*Bitmap, error) {
+	b := new(Bitmap)
+
+	var (
+		pos, key uint64
+		ivs      []interval
+	)
+	flush := func() {
+		if len(ivs) == 0 {
+			return
+		}
+		b.keys = append(b.keys, key)
+		b.containers = append(b.containers, newContainer(ivs))
+		ivs = ivs[:0]
+	}
+
+	for it.HasNext() {
+		run, err := it.NextRun()
+		if err != nil {
+			return nil, err
+		}
+		if math.MaxUint64-run.Len < pos {
+			return nil, xerrors.New("RLE+ overflows")
+		}
+		if !run.Val {
+			pos += run.Len
+			continue
+		}
+
+		for run.Len > 0 {
+			if k := pos >> chunkBits; k != key {
+				flush()
+				key = k
+			}
+			off := pos % chunkSize
+			n := chunkSize - off
+			if run.Len < n {
+				n = run.Len
+			}
+			ivs = append(ivs, interval{start: uint16(off), last: uint16(off + n - 1)})
+			pos += n
+			run.Len -= n
+		}
+	}
+	flush()
+
+	return b, nil
+}
+
+// Cardinality returns the number of set bits.
+func (b *Bitmap) Cardinality() uint64 {
+	var card uint64
+	for _, c := range b.containers {
+		card += uint64(c.cardinality())
+	}
+	return card
+}
+
+// Contains returns true if x is set.
+func (b *Bitmap) Contains(x uint64) bool {
+	i := b.find(x >> chunkBits)
+	if i < 0 {
+		return false
+	}
+	return b.containers[i].contains(uint16(x))
+}
+
+func (b *Bitmap) find(key uint64) int {
+	lo, hi := 0, len(b.keys)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if b.keys[mid] < key {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo < len(b.keys) && b.keys[lo] == key {
+		return lo
+	}
+	return -1
+}
+
+// RunIterator returns an iterator over the runs of the bitmap.
+func (b *Bitmap) RunIterator() (rlepluslazy.RunIterator, error) {
+	it := &runIterator{b: b}
+	it.advance()
+	it.prep()
+	return it, nil
+}
+
+type runIterator struct {
+	b *Bitmap
+
+	// container currently being read, and its remaining intervals
+	idx int
+	ivs []interval
+	buf []interval
+
+	// lookahead range of set bits
+	have     bool
+	hs, hl   uint64
+	pos      uint64
+	next     rlepluslazy.Run
+	pendOnes rlepluslazy.Run
+}
+
+func (it *runIterator) HasNext() bool {
+	return it.next.Valid()
+}
+
+func (it *runIterator) NextRun() (rlepluslazy.Run, error) {
+	out := it.next
+	it.prep()
+	return out, nil
+}
+
+// advance loads the next range of set bits into the lookahead.
+func (it *runIterator) advance() {
+	for len(it.ivs) == 0 {
+		if it.idx >= len(it.b.containers) {
+			it.have = false
+			return
+		}
+		it.buf = it.b.containers[it.idx].intervals(it.buf[:0])
+		it.ivs = it.buf
+		it.idx++
+	}
+	base := it.b.keys[it.idx-1] << chunkBits
+	it.hs = base + uint64(it.ivs[0].start)
+	it.hl = base + uint64(it.ivs[0].last)
+	it.ivs = it.ivs[1:]
+	it.have = true
+}
+
+func (it *runIterator) prep() {
+	if it.pendOnes.Valid() {
+		it.next, it.pendOnes = it.pendOnes, rlepluslazy.Run{}
+		return
+	}
+	if !it.have {
+		it.next = rlepluslazy.Run{}
+		return
+	}
+
+	start, last := it.hs, it.hl
+	it.advance()
+	for it.have && it.hs == last+1 {
+		last = it.hl
+		it.advance()
+	}
+
+	ones := rlepluslazy.Run{Val: true, Len: last - start + 1}
+	if start > it.pos {
+		it.next = rlepluslazy.Run{Val: false, Len: start - it.pos}
+		it.pendOnes = ones
+	} else {
+		it.next = ones
+	}
+	it.pos = last + 1
+}
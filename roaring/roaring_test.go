@@ -0,0 +1,182 @@
+package roaring
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collectRuns(t *testing.T, it rlepluslazy.RunIterator) []rlepluslazy.Run {
+	var runs []rlepluslazy.Run
+	for it.HasNext() {
+		r, err := it.NextRun()
+		require.NoError(t, err)
+		runs = append(runs, r)
+	}
+	return runs
+}
+
+func containerKinds(b *Bitmap) (array, bitmap, run int) {
+	for _, c := range b.containers {
+		switch c.(type) {
+		case arrayContainer:
+			array++
+		case *bitmapContainer:
+			bitmap++
+		case runContainer:
+			run++
+		}
+	}
+	return
+}
+
+func randomSet(seed int64, n int, max uint64) []uint64 {
+	r := rand.New(rand.NewSource(seed))
+	m := make(map[uint64]struct{}, n)
+	for len(m) < n {
+		m[uint64(r.Int63n(int64(max)))] = struct{}{}
+	}
+	out := make([]uint64, 0, n)
+	for x := range m {
+		out = append(out, x)
+	}
+	return out
+}
+
+func TestAdaptiveContainers(t *testing.T) {
+	var tests = []struct {
+		name               string
+		input              []rlepluslazy.Run
+		array, bitmap, run int
+	}{
+		{"sparse", []rlepluslazy.Run{{Val: true, Len: 1}, {Val: false, Len: 10}, {Val: true, Len: 1}}, 1, 0, 0},
+		{"long run", []rlepluslazy.Run{{Val: false, Len: 5}, {Val: true, Len: 3 * chunkSize}}, 0, 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := FromRuns(&rlepluslazy.RunSliceIterator{Runs: tt.input})
+			require.NoError(t, err)
+			array, bitmap, runs := containerKinds(b)
+			assert.Equal(t, tt.array, array)
+			assert.Equal(t, tt.bitmap, bitmap)
+			assert.Equal(t, tt.run, runs)
+		})
+	}
+
+	t.Run("dense random", func(t *testing.T) {
+		set := make([]uint64, 0, chunkSize/2)
+		for i := uint64(0); i < chunkSize; i += 2 {
+			set = append(set, i)
+		}
+		it, err := rlepluslazy.RunsFromSlice(set)
+		require.NoError(t, err)
+		b, err := FromRuns(it)
+		require.NoError(t, err)
+		_, bitmap, _ := containerKinds(b)
+		assert.Equal(t, 1, bitmap)
+	})
+}
+
+func TestRunIteratorRoundTrip(t *testing.T) {
+	for i := int64(0); i < 20; i++ {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			src := rlepluslazy.NewFromZipfDist(i, 1000)
+			expected := collectRuns(t, src)
+
+			b, err := FromRuns(&rlepluslazy.RunSliceIterator{Runs: expected})
+			require.NoError(t, err)
+
+			it, err := b.RunIterator()
+			require.NoError(t, err)
+			actual := collectRuns(t, it)
+
+			// Trailing zeros aren't represented.
+			if !expected[len(expected)-1].Val {
+				expected = expected[:len(expected)-1]
+			}
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	sets := map[string][]uint64{
+		"empty":   nil,
+		"small":   {1, 2, 3},
+		"random":  randomSet(1, 10000, 1<<24),
+		"high":    {0, math.MaxUint32, math.MaxUint32 + 1, math.MaxUint64 - 1},
+		"dense":   randomSet(2, 30000, 1<<16),
+		"ranges":  nil,
+		"manyrun": nil,
+	}
+	for i := uint64(0); i < 100000; i++ {
+		sets["ranges"] = append(sets["ranges"], i+1<<20)
+	}
+	for i := uint64(0); i < 20*chunkSize; i += 3 {
+		sets["manyrun"] = append(sets["manyrun"], i, i+1)
+	}
+
+	for name, set := range sets {
+		t.Run(name, func(t *testing.T) {
+			it, err := rlepluslazy.RunsFromSlice(set)
+			require.NoError(t, err)
+			b, err := FromRuns(it)
+			require.NoError(t, err)
+			assert.EqualValues(t, len(set), b.Cardinality())
+
+			buf, err := b.MarshalBinary()
+			require.NoError(t, err)
+
+			var out Bitmap
+			require.NoError(t, out.UnmarshalBinary(buf))
+			assert.Equal(t, b.keys, out.keys)
+
+			oit, err := out.RunIterator()
+			require.NoError(t, err)
+			bits, err := rlepluslazy.SliceFromRuns(oit)
+			require.NoError(t, err)
+			assert.Equal(t, len(set), len(bits))
+			for _, x := range set {
+				assert.True(t, out.Contains(x))
+			}
+		})
+	}
+}
+
+func TestSerializeFormat(t *testing.T) {
+	it, err := rlepluslazy.RunsFromSlice([]uint64{1, 2, 3})
+	require.NoError(t, err)
+	b, err := FromRuns(it)
+	require.NoError(t, err)
+
+	buf, err := b.MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		1, 0, 0, 0, 0, 0, 0, 0, // number of 32-bit bitmaps
+		0, 0, 0, 0, // high bits
+		0x3b, 0x30, 0, 0, // cookie
+		1, 0, 0, 0, // number of containers
+		0, 0, 2, 0, // key, cardinality - 1
+		16, 0, 0, 0, // offset
+		1, 0, 2, 0, 3, 0, // array container
+	}, buf)
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	it, err := rlepluslazy.RunsFromSlice(randomSet(3, 100, 1<<20))
+	require.NoError(t, err)
+	b, err := FromRuns(it)
+	require.NoError(t, err)
+	buf, err := b.MarshalBinary()
+	require.NoError(t, err)
+
+	var out Bitmap
+	assert.Error(t, out.UnmarshalBinary(buf[:len(buf)-1]))
+	assert.Error(t, out.UnmarshalBinary(append(buf, 0)))
+	assert.Error(t, out.UnmarshalBinary([]byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4}))
+}
@@ -0,0 +1,300 @@
+package roaring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// Serialization follows the portable roaring format for 64-bit bitmaps: a
+// little-endian uint64 count of 32-bit bitmaps, each prefixed with the
+// little-endian uint32 high bits of its indices and serialized in the portable
+// 32-bit roaring format.
+//
+// https://github.com/RoaringBitmap/RoaringFormatSpec
+const (
+	serialCookieNoRunContainer = 12347
+	serialCookie               = 12346
+	noOffsetThreshold          = 4
+)
+
+var ErrInvalidFormat = errors.New("invalid roaring bitmap")
+
+// MarshalBinary serializes the bitmap in the portable roaring format.
+func (b *Bitmap) MarshalBinary() ([]byte, error) {
+	var out []byte
+
+	var groups int
+	for i := range b.keys {
+		if i == 0 || b.keys[i]>>chunkBits != b.keys[i-1]>>chunkBits {
+			groups++
+		}
+	}
+	out = binary.LittleEndian.AppendUint64(out, uint64(groups))
+
+	for i := 0; i < len(b.keys); {
+		high := b.keys[i] >> chunkBits
+		j := i
+		for j < len(b.keys) && b.keys[j]>>chunkBits == high {
+			j++
+		}
+		out = binary.LittleEndian.AppendUint32(out, uint32(high))
+		out = appendBitmap32(out, b.keys[i:j], b.containers[i:j])
+		i = j
+	}
+	return out, nil
+}
+
+// appendBitmap32 appends the portable 32-bit roaring serialization of the given
+// containers to out.
+func appendBitmap32(out []byte, keys []uint64, containers []container) []byte {
+	size := len(containers)
+
+	var runFlags []byte
+	for i, c := range containers {
+		if _, ok := c.(runContainer); ok {
+			if runFlags == nil {
+				runFlags = make([]byte, (size+7)/8)
+			}
+			runFlags[i/8] |= 1 << (i % 8)
+		}
+	}
+
+	start := len(out)
+	if runFlags != nil {
+		out = binary.LittleEndian.AppendUint32(out, serialCookie|uint32(size-1)<<16)
+		out = append(out, runFlags...)
+	} else {
+		out = binary.LittleEndian.AppendUint32(out, serialCookieNoRunContainer)
+		out = binary.LittleEndian.AppendUint32(out, uint32(size))
+	}
+
+	for i, c := range containers {
+		out = binary.LittleEndian.AppendUint16(out, uint16(keys[i]))
+		out = binary.LittleEndian.AppendUint16(out, uint16(c.cardinality()-1))
+	}
+
+	if runFlags == nil || size >= noOffsetThreshold {
+		offset := len(out) - start + 4*size
+		for _, c := range containers {
+			out = binary.LittleEndian.AppendUint32(out, uint32(offset))
+			offset += c.serializedSize()
+		}
+	}
+
+	for _, c := range containers {
+		switch c := c.(type) {
+		case arrayContainer:
+			for _, x := range c {
+				out = binary.LittleEndian.AppendUint16(out, x)
+			}
+		case *bitmapContainer:
+			for _, w := range c.words {
+				out = binary.LittleEndian.AppendUint64(out, w)
+			}
+		case runContainer:
+			out = binary.LittleEndian.AppendUint16(out, uint16(len(c)))
+			for _, iv := range c {
+				out = binary.LittleEndian.AppendUint16(out, iv.start)
+				out = binary.LittleEndian.AppendUint16(out, iv.last-iv.start)
+			}
+		}
+	}
+	return out
+}
+
+// UnmarshalBinary decodes a bitmap in the portable roaring format, replacing
+// the contents of b.
+func (b *Bitmap) UnmarshalBinary(data []byte) error {
+	r := reader{buf: data}
+
+	groups, err := r.uint64()
+	if err != nil {
+		return err
+	}
+	if groups > uint64(len(data)) {
+		return fmt.Errorf("too many bitmaps (%d): %w", groups, ErrInvalidFormat)
+	}
+
+	var res Bitmap
+	for g := uint64(0); g < groups; g++ {
+		high, err := r.uint32()
+		if err != nil {
+			return err
+		}
+		if err := res.readBitmap32(&r, uint64(high)<<chunkBits); err != nil {
+			return err
+		}
+	}
+	if len(r.buf) != 0 {
+		return fmt.Errorf("trailing data: %w", ErrInvalidFormat)
+	}
+	if res.Contains(math.MaxUint64) {
+		// Runs can't represent the last index, as they end one past it.
+		return fmt.Errorf("bit %d is out of range: %w", uint64(math.MaxUint64), ErrInvalidFormat)
+	}
+
+	*b = res
+	return nil
+}
+
+func (b *Bitmap) readBitmap32(r *reader, high uint64) error {
+	cookie, err := r.uint32()
+	if err != nil {
+		return err
+	}
+
+	var (
+		size     int
+		runFlags []byte
+	)
+	switch {
+	case cookie&0xffff == serialCookie:
+		size = int(cookie>>16) + 1
+		if runFlags, err = r.bytes((size + 7) / 8); err != nil {
+			return err
+		}
+	case cookie == serialCookieNoRunContainer:
+		n, err := r.uint32()
+		if err != nil {
+			return err
+		}
+		if n > 1<<16 {
+			return fmt.Errorf("too many containers (%d): %w", n, ErrInvalidFormat)
+		}
+		size = int(n)
+	default:
+		return fmt.Errorf("unknown cookie %d: %w", cookie, ErrInvalidFormat)
+	}
+
+	header, err := r.bytes(4 * size)
+	if err != nil {
+		return err
+	}
+	if runFlags == nil || size >= noOffsetThreshold {
+		// Offsets are only needed for random access; containers are read
+		// sequentially.
+		if _, err := r.bytes(4 * size); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < size; i++ {
+		key := high | uint64(binary.LittleEndian.Uint16(header[4*i:]))
+		card := int(binary.LittleEndian.Uint16(header[4*i+2:])) + 1
+		if n := len(b.keys); n > 0 && b.keys[n-1] >= key {
+			return fmt.Errorf("containers out of order: %w", ErrInvalidFormat)
+		}
+
+		var c container
+		switch {
+		case runFlags != nil && runFlags[i/8]&(1<<(i%8)) != 0:
+			c, err = r.runContainer()
+		case card > maxArrayCardinality:
+			c, err = r.bitmapContainer()
+		default:
+			c, err = r.arrayContainer(card)
+		}
+		if err != nil {
+			return err
+		}
+		if c.cardinality() != card {
+			return fmt.Errorf("container cardinality mismatch: %w", ErrInvalidFormat)
+		}
+
+		b.keys = append(b.keys, key)
+		b.containers = append(b.containers, c)
+	}
+	return nil
+}
+
+type reader struct {
+	buf []byte
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if len(r.buf) < n {
+		return nil, fmt.Errorf("unexpected end of data: %w", ErrInvalidFormat)
+	}
+	out := r.buf[:n]
+	r.buf = r.buf[n:]
+	return out, nil
+}
+
+func (r *reader) uint16() (uint16, error) {
+	b, err := r.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(b), nil
+}
+
+func (r *reader) uint32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+func (r *reader) uint64() (uint64, error) {
+	b, err := r.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(b), nil
+}
+
+func (r *reader) arrayContainer(card int) (container, error) {
+	b, err := r.bytes(2 * card)
+	if err != nil {
+		return nil, err
+	}
+	ac := make(arrayContainer, card)
+	for i := range ac {
+		ac[i] = binary.LittleEndian.Uint16(b[2*i:])
+		if i > 0 && ac[i] <= ac[i-1] {
+			return nil, fmt.Errorf("array container not sorted: %w", ErrInvalidFormat)
+		}
+	}
+	return ac, nil
+}
+
+func (r *reader) bitmapContainer() (container, error) {
+	b, err := r.bytes(8 * bitmapWords)
+	if err != nil {
+		return nil, err
+	}
+	bc := new(bitmapContainer)
+	for i := range bc.words {
+		bc.words[i] = binary.LittleEndian.Uint64(b[8*i:])
+		bc.card += bits.OnesCount64(bc.words[i])
+	}
+	return bc, nil
+}
+
+func (r *reader) runContainer() (container, error) {
+	n, err := r.uint16()
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.bytes(4 * int(n))
+	if err != nil {
+		return nil, err
+	}
+	rc := make(runContainer, n)
+	for i := range rc {
+		start := binary.LittleEndian.Uint16(b[4*i:])
+		length := binary.LittleEndian.Uint16(b[4*i+2:])
+		if int(start)+int(length) >= chunkSize {
+			return nil, fmt.Errorf("run exceeds container: %w", ErrInvalidFormat)
+		}
+		if i > 0 && start <= rc[i-1].last {
+			return nil, fmt.Errorf("runs overlap: %w", ErrInvalidFormat)
+		}
+		rc[i] = interval{start: start, last: start + length}
+	}
+	return rc, nil
+}
@@ -0,0 +1,72 @@
+package bitfield
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/filecoin-project/go-bitfield/roaring"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestRoaringRoundTrip(t *testing.T) {
+	for i := int64(0); i < 10; i++ {
+		set := getRandIndexSetSeed(10000, i)
+		bf := NewFromSet(set)
+
+		buf, err := bf.MarshalRoaring()
+		require.NoError(t, err)
+
+		out, err := NewFromRoaring(buf)
+		require.NoError(t, err)
+
+		bits, err := out.All(10000)
+		require.NoError(t, err)
+		assert.Equal(t, set, bits)
+	}
+}
+
+func TestRoaringRandomIsSmaller(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	bf := New()
+	for i := 0; i < 30000; i++ {
+		bf.Set(uint64(r.Int63n(1 << 16)))
+	}
+
+	rb, err := bf.MarshalRoaring()
+	require.NoError(t, err)
+
+	rleBf, err := bf.Copy()
+	require.NoError(t, err)
+
+	t.Logf("roaring: %d bytes, rle+: %d bytes", len(rb), len(rleBf.rle.Bytes()))
+	assert.Less(t, len(rb), len(rleBf.rle.Bytes()))
+}
+
+func TestRoaringInvalid(t *testing.T) {
+	_, err := NewFromRoaring([]byte{1, 2, 3})
+	assert.Error(t, err)
+
+	// Bit 2^64-1 can't be represented as runs.
+	_, err = NewFromRoaring([]byte{
+		1, 0, 0, 0, 0, 0, 0, 0, // number of 32-bit bitmaps
+		0xff, 0xff, 0xff, 0xff, // high bits
+		0x3b, 0x30, 0, 0, // cookie
+		1, 0, 0, 0, // number of containers
+		0xff, 0xff, 0, 0, // key, cardinality - 1
+		16, 0, 0, 0, // offset
+		0xfe, 0xff, // array container
+	})
+	require.NoError(t, err)
+	_, err = NewFromRoaring([]byte{
+		1, 0, 0, 0, 0, 0, 0, 0, // number of 32-bit bitmaps
+		0xff, 0xff, 0xff, 0xff, // high bits
+		0x3b, 0x30, 0, 0, // cookie
+		1, 0, 0, 0, // number of containers
+		0xff, 0xff, 0, 0, // key, cardinality - 1
+		16, 0, 0, 0, // offset
+		0xff, 0xff, // array container
+	})
+	assert.True(t, xerrors.Is(err, roaring.ErrInvalidFormat))
+}
@@ -0,0 +1,362 @@
+package bitfield
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+	cbg "github.com/whyrusleeping/cbor-gen"
+	"golang.org/x/xerrors"
+)
+
+// ShardedBitField is a paged bitfield whose pages are stored as separate CBOR
+// blocks in a BlockStore, referenced by a root block.
+//
+// Pages are only loaded when needed, so point queries such as IsSet only read a
+// single block, and modifications only rewrite the modified page. Call Flush to
+// write the root block after modifying the bitfield.
+//
+// The zero value is an empty bitfield without a store or page size. Methods
+// that need them return ErrInvalidPageSize.
+type ShardedBitField struct {
+	store    BlockStore
+	pageSize uint64
+	pages    map[uint64]string
+}
+
+// NewSharded constructs a new, empty ShardedBitField backed by store. It panics
+// if pageSize is zero.
+func NewSharded(store BlockStore, pageSize uint64) ShardedBitField {
+	if pageSize == 0 {
+		panic(ErrInvalidPageSize)
+	}
+	return ShardedBitField{
+		store:    store,
+		pageSize: pageSize,
+		pages:    make(map[uint64]string),
+	}
+}
+
+// NewShardedFromIter constructs a ShardedBitField from the RunIterator, writing
+// each non-empty page to store. The root block is not written until Flush is
+// called.
+//
+// This operation's runtime is O(number of runs + number of pages).
+func NewShardedFromIter(store BlockStore, pageSize uint64, r rlepluslazy.RunIterator) (ShardedBitField, error) {
+	if pageSize == 0 {
+		return ShardedBitField{}, ErrInvalidPageSize
+	}
+	sb := NewSharded(store, pageSize)
+	err := splitPages(r, pageSize, func(page uint64, runs []rlepluslazy.Run) error {
+		buf, err := rlepluslazy.EncodeRuns(&rlepluslazy.RunSliceIterator{Runs: runs}, nil)
+		if err != nil {
+			return err
+		}
+		key, err := sb.putPage(buf)
+		if err != nil {
+			return err
+		}
+		sb.pages[page] = key
+		return nil
+	})
+	if err != nil {
+		return ShardedBitField{}, err
+	}
+	return sb, nil
+}
+
+// LoadSharded loads the ShardedBitField with the given root block from store.
+// Pages are loaded lazily.
+func LoadSharded(store BlockStore, root string) (ShardedBitField, error) {
+	data, err := getBlock(store, root)
+	if err != nil {
+		return ShardedBitField{}, xerrors.Errorf("loading root block: %w", err)
+	}
+
+	r := bytes.NewReader(data)
+	maj, extra, err := cbg.CborReadHeader(r)
+	if err != nil {
+		return ShardedBitField{}, err
+	}
+	if maj != cbg.MajArray || extra != 2 {
+		return ShardedBitField{}, fmt.Errorf("expected root to be an array of 2 elements")
+	}
+
+	maj, pageSize, err := cbg.CborReadHeader(r)
+	if err != nil {
+		return ShardedBitField{}, err
+	}
+	if maj != cbg.MajUnsignedInt {
+		return ShardedBitField{}, fmt.Errorf("expected page size to be an unsigned integer")
+	}
+	if pageSize == 0 {
+		return ShardedBitField{}, ErrInvalidPageSize
+	}
+
+	maj, n, err := cbg.CborReadHeader(r)
+	if err != nil {
+		return ShardedBitField{}, err
+	}
+	if maj != cbg.MajArray {
+		return ShardedBitField{}, fmt.Errorf("expected pages to be an array")
+	}
+	if n > uint64(r.Len()) {
+		return ShardedBitField{}, fmt.Errorf("too many pages")
+	}
+
+	sb := NewSharded(store, pageSize)
+	for i := uint64(0); i < n; i++ {
+		maj, extra, err := cbg.CborReadHeader(r)
+		if err != nil {
+			return ShardedBitField{}, err
+		}
+		if maj != cbg.MajArray || extra != 2 {
+			return ShardedBitField{}, fmt.Errorf("expected page entry to be an array of 2 elements")
+		}
+
+		maj, page, err := cbg.CborReadHeader(r)
+		if err != nil {
+			return ShardedBitField{}, err
+		}
+		if maj != cbg.MajUnsignedInt {
+			return ShardedBitField{}, fmt.Errorf("expected page index to be an unsigned integer")
+		}
+		if _, ok := sb.pages[page]; ok {
+			return ShardedBitField{}, fmt.Errorf("duplicate page %d", page)
+		}
+
+		key, err := cbg.ReadString(r)
+		if err != nil {
+			return ShardedBitField{}, err
+		}
+		sb.pages[page] = key
+	}
+	if r.Len() != 0 {
+		return ShardedBitField{}, fmt.Errorf("unexpected trailing data in root block")
+	}
+	return sb, nil
+}
+
+// Flush writes the root block to the store and returns its key.
+func (sb ShardedBitField) Flush() (string, error) {
+	if sb.pageSize == 0 {
+		return "", ErrInvalidPageSize
+	}
+	var buf bytes.Buffer
+	if err := cbg.CborWriteHeader(&buf, cbg.MajArray, 2); err != nil {
+		return "", err
+	}
+	if err := cbg.CborWriteHeader(&buf, cbg.MajUnsignedInt, sb.pageSize); err != nil {
+		return "", err
+	}
+
+	pages := sb.sortedPages()
+	if err := cbg.CborWriteHeader(&buf, cbg.MajArray, uint64(len(pages))); err != nil {
+		return "", err
+	}
+	for _, page := range pages {
+		key := sb.pages[page]
+		if err := cbg.CborWriteHeader(&buf, cbg.MajArray, 2); err != nil {
+			return "", err
+		}
+		if err := cbg.CborWriteHeader(&buf, cbg.MajUnsignedInt, page); err != nil {
+			return "", err
+		}
+		if err := cbg.CborWriteHeader(&buf, cbg.MajTextString, uint64(len(key))); err != nil {
+			return "", err
+		}
+		if _, err := io.WriteString(&buf, key); err != nil {
+			return "", err
+		}
+	}
+
+	return sb.put(buf.Bytes())
+}
+
+// PageSize returns the number of bits covered by each page.
+func (sb ShardedBitField) PageSize() uint64 {
+	return sb.pageSize
+}
+
+// NumPages returns the number of non-empty pages.
+func (sb ShardedBitField) NumPages() int {
+	return len(sb.pages)
+}
+
+// RunIterator returns an iterator over the runs of the entire bitfield. Pages
+// are loaded from the store as the iterator reaches them.
+func (sb ShardedBitField) RunIterator() (rlepluslazy.RunIterator, error) {
+	return newPageIterator(sb.pageSize, sb.sortedPages(), func(page uint64) (rlepluslazy.RunIterator, error) {
+		rle, err := sb.loadPage(page)
+		if err != nil {
+			return nil, err
+		}
+		return rle.RunIterator()
+	})
+}
+
+// IsSet returns true if the given bit is set.
+//
+// This operation loads at most one page.
+func (sb ShardedBitField) IsSet(x uint64) (bool, error) {
+	if sb.pageSize == 0 {
+		return false, ErrInvalidPageSize
+	}
+	page := x / sb.pageSize
+	if _, ok := sb.pages[page]; !ok {
+		return false, nil
+	}
+	rle, err := sb.loadPage(page)
+	if err != nil {
+		return false, err
+	}
+	iter, err := rle.RunIterator()
+	if err != nil {
+		return false, err
+	}
+	return rlepluslazy.IsSet(iter, x%sb.pageSize)
+}
+
+// Count counts the non-zero bits in the bitfield.
+//
+// This operation loads every page.
+func (sb ShardedBitField) Count() (uint64, error) {
+	var count uint64
+	for page := range sb.pages {
+		rle, err := sb.loadPage(page)
+		if err != nil {
+			return 0, err
+		}
+		c, err := rle.Count()
+		if err != nil {
+			return 0, err
+		}
+		count += c
+	}
+	return count, nil
+}
+
+// Set sets the given bit, rewriting the page that contains it.
+func (sb ShardedBitField) Set(bit uint64) error {
+	return sb.updatePage(bit, rlepluslazy.Or)
+}
+
+// Unset unsets the given bit, rewriting the page that contains it.
+func (sb ShardedBitField) Unset(bit uint64) error {
+	return sb.updatePage(bit, rlepluslazy.Subtract)
+}
+
+func (sb ShardedBitField) updatePage(bit uint64, op pageOp) error {
+	if sb.pageSize == 0 {
+		return ErrInvalidPageSize
+	}
+	page := bit / sb.pageSize
+
+	var rle rlepluslazy.RLE
+	if _, ok := sb.pages[page]; ok {
+		var err error
+		rle, err = sb.loadPage(page)
+		if err != nil {
+			return err
+		}
+	}
+
+	rle, err := updateRLE(rle, bit%sb.pageSize, op)
+	if err != nil {
+		return err
+	}
+
+	if len(rle.Bytes()) == 0 {
+		delete(sb.pages, page)
+		return nil
+	}
+
+	key, err := sb.putPage(rle.Bytes())
+	if err != nil {
+		return err
+	}
+	sb.pages[page] = key
+	return nil
+}
+
+func (sb ShardedBitField) sortedPages() []uint64 {
+	pages := make([]uint64, 0, len(sb.pages))
+	for page := range sb.pages {
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i] < pages[j] })
+	return pages
+}
+
+func (sb ShardedBitField) loadPage(page uint64) (rlepluslazy.RLE, error) {
+	data, err := getBlock(sb.store, sb.pages[page])
+	if err != nil {
+		return rlepluslazy.RLE{}, xerrors.Errorf("loading page %d: %w", page, err)
+	}
+
+	r := bytes.NewReader(data)
+	maj, extra, err := cbg.CborReadHeader(r)
+	if err != nil {
+		return rlepluslazy.RLE{}, err
+	}
+	if maj != cbg.MajByteString {
+		return rlepluslazy.RLE{}, fmt.Errorf("expected byte array")
+	}
+	if extra != uint64(r.Len()) {
+		return rlepluslazy.RLE{}, fmt.Errorf("page %d has an invalid length", page)
+	}
+
+	rle, err := rlepluslazy.FromBuf(data[len(data)-r.Len():])
+	if err != nil {
+		return rlepluslazy.RLE{}, xerrors.Errorf("could not decode rle+: %w", err)
+	}
+
+	// The runs of a page must stay within the page.
+	summary, err := rle.Summary()
+	if err != nil {
+		return rlepluslazy.RLE{}, xerrors.Errorf("page %d: %w", page, err)
+	}
+	start := page * sb.pageSize
+	if page != 0 && start/page != sb.pageSize {
+		return rlepluslazy.RLE{}, xerrors.Errorf("page %d is out of range", page)
+	}
+	if summary.Count > 0 && (summary.Last >= sb.pageSize || math.MaxUint64-start < summary.Last) {
+		return rlepluslazy.RLE{}, xerrors.Errorf("page %d has bit %d out of range for page size %d", page, summary.Last, sb.pageSize)
+	}
+	return rle, nil
+}
+
+// getBlock gets a block from store, checking that it matches its key.
+func getBlock(store BlockStore, key string) ([]byte, error) {
+	data, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if blockKey(data) != key {
+		return nil, xerrors.Errorf("block %s: %w", key, ErrBlockMismatch)
+	}
+	return data, nil
+}
+
+func blockKey(block []byte) string {
+	sum := sha256.Sum256(block)
+	return hex.EncodeToString(sum[:])
+}
+
+func (sb ShardedBitField) putPage(rle []byte) (string, error) {
+	block := append(cbg.CborEncodeMajorType(cbg.MajByteString, uint64(len(rle))), rle...)
+	return sb.put(block)
+}
+
+func (sb ShardedBitField) put(block []byte) (string, error) {
+	key := blockKey(block)
+	if err := sb.store.Put(key, block); err != nil {
+		return "", xerrors.Errorf("storing block: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,192 @@
+package bitfield
+
+import (
+	"testing"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+type countingStore struct {
+	BlockStore
+	gets, puts int
+}
+
+func (cs *countingStore) Get(key string) ([]byte, error) {
+	cs.gets++
+	return cs.BlockStore.Get(key)
+}
+
+func (cs *countingStore) Put(key string, data []byte) error {
+	cs.puts++
+	return cs.BlockStore.Put(key, data)
+}
+
+func TestShardedRoundTrip(t *testing.T) {
+	store := NewMemBlockStore()
+
+	set := getRandIndexSet(10000)
+	iter, err := rlepluslazy.RunsFromSlice(set)
+	require.NoError(t, err)
+
+	sb, err := NewShardedFromIter(store, 512, iter)
+	require.NoError(t, err)
+	root, err := sb.Flush()
+	require.NoError(t, err)
+
+	loaded, err := LoadSharded(store, root)
+	require.NoError(t, err)
+	assert.Equal(t, sb.NumPages(), loaded.NumPages())
+	assert.EqualValues(t, 512, loaded.PageSize())
+
+	out, err := loaded.RunIterator()
+	require.NoError(t, err)
+	bits, err := rlepluslazy.SliceFromRuns(out)
+	require.NoError(t, err)
+	assert.Equal(t, set, bits)
+
+	count, err := loaded.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, len(set), count)
+}
+
+func TestShardedPartialAccess(t *testing.T) {
+	set := getRandIndexSet(10000)
+	iter, err := rlepluslazy.RunsFromSlice(set)
+	require.NoError(t, err)
+
+	mem := NewMemBlockStore()
+	sb, err := NewShardedFromIter(mem, 1000, iter)
+	require.NoError(t, err)
+	root, err := sb.Flush()
+	require.NoError(t, err)
+
+	store := &countingStore{BlockStore: mem}
+	loaded, err := LoadSharded(store, root)
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.gets)
+
+	isSet, err := loaded.IsSet(set[len(set)/2])
+	require.NoError(t, err)
+	assert.True(t, isSet)
+	assert.Equal(t, 2, store.gets)
+
+	require.NoError(t, loaded.Set(20000))
+	assert.Equal(t, 2, store.gets)
+	assert.Equal(t, 1, store.puts)
+
+	require.NoError(t, loaded.Unset(set[0]))
+	assert.Equal(t, 3, store.gets)
+	assert.Equal(t, 2, store.puts)
+
+	newRoot, err := loaded.Flush()
+	require.NoError(t, err)
+	assert.Equal(t, 3, store.puts)
+	assert.NotEqual(t, root, newRoot)
+
+	reloaded, err := LoadSharded(mem, newRoot)
+	require.NoError(t, err)
+	out, err := reloaded.RunIterator()
+	require.NoError(t, err)
+	bits, err := rlepluslazy.SliceFromRuns(out)
+	require.NoError(t, err)
+	assert.Equal(t, append(set[1:], 20000), bits)
+
+	// The original root is untouched.
+	original, err := LoadSharded(mem, root)
+	require.NoError(t, err)
+	out, err = original.RunIterator()
+	require.NoError(t, err)
+	bits, err = rlepluslazy.SliceFromRuns(out)
+	require.NoError(t, err)
+	assert.Equal(t, set, bits)
+}
+
+func TestShardedEmpty(t *testing.T) {
+	store := NewMemBlockStore()
+	sb := NewSharded(store, 64)
+
+	root, err := sb.Flush()
+	require.NoError(t, err)
+
+	loaded, err := LoadSharded(store, root)
+	require.NoError(t, err)
+
+	out, err := loaded.RunIterator()
+	require.NoError(t, err)
+	assert.False(t, out.HasNext())
+
+	require.NoError(t, loaded.Set(5))
+	require.NoError(t, loaded.Unset(5))
+	assert.Equal(t, 0, loaded.NumPages())
+}
+
+func TestShardedMissingBlock(t *testing.T) {
+	_, err := LoadSharded(NewMemBlockStore(), "missing")
+	require.True(t, xerrors.Is(err, ErrBlockNotFound))
+}
+
+func TestShardedCorruptBlock(t *testing.T) {
+	store := NewMemBlockStore()
+	iter, err := rlepluslazy.RunsFromSlice([]uint64{1, 2, 100})
+	require.NoError(t, err)
+	sb, err := NewShardedFromIter(store, 64, iter)
+	require.NoError(t, err)
+	root, err := sb.Flush()
+	require.NoError(t, err)
+
+	// Replace the page holding bit 100 with a different, valid page.
+	key := sb.pages[1]
+	require.NoError(t, store.Put(key, marshalBytes(t, NewFromSet([]uint64{5}))))
+
+	loaded, err := LoadSharded(store, root)
+	require.NoError(t, err)
+	_, err = loaded.IsSet(100)
+	assert.True(t, xerrors.Is(err, ErrBlockMismatch))
+	_, err = loaded.Count()
+	assert.True(t, xerrors.Is(err, ErrBlockMismatch))
+
+	require.NoError(t, store.Put(root, []byte{0x82, 0x01, 0x80}))
+	_, err = LoadSharded(store, root)
+	assert.True(t, xerrors.Is(err, ErrBlockMismatch))
+}
+
+func TestShardedPageOutOfBounds(t *testing.T) {
+	store := NewMemBlockStore()
+	sb := NewSharded(store, 64)
+
+	// A correctly addressed page with bits past the end of the page.
+	key, err := sb.put(marshalBytes(t, NewFromSet([]uint64{3, 200})))
+	require.NoError(t, err)
+	sb.pages[0] = key
+
+	_, err = sb.Count()
+	assert.Error(t, err)
+	_, err = sb.IsSet(3)
+	assert.Error(t, err)
+
+	// A page whose index overflows the index space.
+	key, err = sb.put(marshalBytes(t, NewFromSet([]uint64{3})))
+	require.NoError(t, err)
+	sb.pages = map[uint64]string{1 << 60: key}
+	_, err = sb.Count()
+	assert.Error(t, err)
+}
+
+func TestShardedZeroValue(t *testing.T) {
+	assert.Panics(t, func() { NewSharded(NewMemBlockStore(), 0) })
+
+	var sb ShardedBitField
+	_, err := sb.IsSet(1)
+	assert.Equal(t, ErrInvalidPageSize, err)
+	assert.Equal(t, ErrInvalidPageSize, sb.Set(1))
+	assert.Equal(t, ErrInvalidPageSize, sb.Unset(1))
+	_, err = sb.Flush()
+	assert.Equal(t, ErrInvalidPageSize, err)
+
+	count, err := sb.Count()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), count)
+}
@@ -0,0 +1,194 @@
+package bitfield
+
+import (
+	"golang.org/x/xerrors"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+)
+
+// SplitByEncodedSize partitions the set bits into consecutive bitfields that
+// each encode to at most maxBytes bytes. Bits keep their positions, so the
+// union of the returned bitfields is the original bitfield.
+//
+// A run of set bits is split across bitfields when it doesn't fit. An error is
+// returned if a single bit can't be encoded in maxBytes.
+func (bf BitField) SplitByEncodedSize(maxBytes int) ([]BitField, error) {
+	if maxBytes <= 0 {
+		return nil, xerrors.Errorf("invalid max encoded size %d", maxBytes)
+	}
+
+	var (
+		s  splitter
+		sc rlepluslazy.SizeCounter
+	)
+
+	// fit returns the largest prefix of the run that can be added to the current
+	// chunk. Encoded sizes only grow with the length of the run, so we can
+	// binary search for it.
+	fit := func(start, length uint64) (uint64, error) {
+		fits := func(l uint64) (bool, error) {
+			next := sc
+			if gap := start - s.end; gap > 0 {
+				if err := next.Add(rlepluslazy.Run{Val: false, Len: gap}); err != nil {
+					return false, err
+				}
+			}
+			if err := next.Add(rlepluslazy.Run{Val: true, Len: l}); err != nil {
+				return false, err
+			}
+			return next.Size() <= maxBytes, nil
+		}
+
+		lo, hi := uint64(0), length
+		for lo < hi {
+			mid := hi - (hi-lo)/2
+			ok, err := fits(mid)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		return lo, nil
+	}
+
+	err := s.split(bf, func(start, length uint64) (uint64, bool, error) {
+		l, err := fit(start, length)
+		if err != nil {
+			return 0, false, err
+		}
+		if l == 0 && len(s.runs) == 0 {
+			return 0, false, xerrors.Errorf("bit %d cannot be encoded in %d bytes", start, maxBytes)
+		}
+		if l > 0 {
+			if gap := start - s.end; gap > 0 {
+				if err := sc.Add(rlepluslazy.Run{Val: false, Len: gap}); err != nil {
+					return 0, false, err
+				}
+			}
+			if err := sc.Add(rlepluslazy.Run{Val: true, Len: l}); err != nil {
+				return 0, false, err
+			}
+		}
+		if l < length {
+			sc = rlepluslazy.SizeCounter{}
+			return l, true, nil
+		}
+		return l, false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.chunks, nil
+}
+
+// SplitByCount partitions the set bits into consecutive bitfields with at most
+// n set bits each. Bits keep their positions, so the union of the returned
+// bitfields is the original bitfield.
+func (bf BitField) SplitByCount(n uint64) ([]BitField, error) {
+	if n == 0 {
+		return nil, xerrors.New("cannot split into bitfields of zero bits")
+	}
+
+	var (
+		s     splitter
+		count uint64
+	)
+	err := s.split(bf, func(start, length uint64) (uint64, bool, error) {
+		l := n - count
+		if length < l {
+			l = length
+		}
+		count += l
+		if count == n {
+			count = 0
+			return l, true, nil
+		}
+		return l, false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.chunks, nil
+}
+
+// splitter builds the chunks of a split bitfield from runs of set bits.
+type splitter struct {
+	chunks []BitField
+	runs   []rlepluslazy.Run
+	end    uint64 // position after the last run in the current chunk
+}
+
+// split streams over the runs of bf. For each run of set bits, take is called
+// with the position and length of the part of the run that hasn't been
+// assigned to a chunk yet, and returns how much of it to add to the current
+// chunk and whether the chunk is full.
+func (s *splitter) split(bf BitField, take func(start, length uint64) (uint64, bool, error)) error {
+	it, err := bf.RunIterator()
+	if err != nil {
+		return err
+	}
+
+	var pos uint64
+	for it.HasNext() {
+		r, err := it.NextRun()
+		if err != nil {
+			return err
+		}
+		if !r.Val {
+			pos += r.Len
+			continue
+		}
+
+		start, length := pos, r.Len
+		pos += r.Len
+		for length > 0 {
+			l, full, err := take(start, length)
+			if err != nil {
+				return err
+			}
+			if l > 0 {
+				s.add(start, l)
+				start += l
+				length -= l
+			}
+			if full {
+				if err := s.flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return s.flush()
+}
+
+func (s *splitter) add(start, length uint64) {
+	if gap := start - s.end; gap > 0 {
+		s.runs = append(s.runs, rlepluslazy.Run{Val: false, Len: gap})
+	}
+	s.runs = append(s.runs, rlepluslazy.Run{Val: true, Len: length})
+	s.end = start + length
+}
+
+func (s *splitter) flush() error {
+	if len(s.runs) == 0 {
+		return nil
+	}
+
+	buf, err := rlepluslazy.EncodeRuns(&rlepluslazy.RunSliceIterator{Runs: s.runs}, nil)
+	if err != nil {
+		return err
+	}
+	rle, err := rlepluslazy.FromBuf(buf)
+	if err != nil {
+		return err
+	}
+
+	s.chunks = append(s.chunks, newWithRle(rle))
+	s.runs = s.runs[:0]
+	s.end = 0
+	return nil
+}
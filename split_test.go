@@ -0,0 +1,125 @@
+package bitfield
+
+import (
+	"testing"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checkSplit(t *testing.T, bf BitField, chunks []BitField) {
+	t.Helper()
+
+	expected, err := bf.All(100000000)
+	require.NoError(t, err)
+
+	var all []uint64
+	for _, c := range chunks {
+		bits, err := c.All(100000000)
+		require.NoError(t, err)
+		require.NotEmpty(t, bits)
+		if len(all) > 0 {
+			require.Less(t, all[len(all)-1], bits[0], "chunks must be consecutive")
+		}
+		all = append(all, bits...)
+	}
+	assert.Equal(t, expected, all)
+}
+
+func TestSplitByEncodedSize(t *testing.T) {
+	bf := NewFromSet(getRandIndexSet(20000))
+	size, err := bf.EncodedSize()
+	require.NoError(t, err)
+
+	for _, maxBytes := range []int{8, 100, 1000, size, size + 1} {
+		chunks, err := bf.SplitByEncodedSize(maxBytes)
+		require.NoError(t, err)
+		checkSplit(t, bf, chunks)
+
+		for i, c := range chunks {
+			s, err := c.EncodedSize()
+			require.NoError(t, err)
+			assert.LessOrEqual(t, s, maxBytes)
+
+			// Each chunk but the last must have been full, so the first bit
+			// of the next chunk wouldn't have fit.
+			if i < len(chunks)-1 {
+				next, err := chunks[i+1].First()
+				require.NoError(t, err)
+				c.Set(next)
+				s, err := c.EncodedSize()
+				require.NoError(t, err)
+				assert.Greater(t, s, maxBytes)
+			}
+		}
+		if maxBytes >= size {
+			assert.Len(t, chunks, 1)
+		}
+	}
+}
+
+func TestSplitByEncodedSizeLongRun(t *testing.T) {
+	bf, err := NewFromIter(&rlepluslazy.RunSliceIterator{Runs: []rlepluslazy.Run{
+		{Val: false, Len: 1 << 21},
+		{Val: true, Len: 1<<22 + 1000},
+	}})
+	require.NoError(t, err)
+
+	// After the header and the leading zeros, only run lengths below 1<<22
+	// fit in 8 bytes, so the run must be split.
+	chunks, err := bf.SplitByEncodedSize(8)
+	require.NoError(t, err)
+	assert.Len(t, chunks, 2)
+
+	var total uint64
+	for _, c := range chunks {
+		s, err := c.EncodedSize()
+		require.NoError(t, err)
+		assert.LessOrEqual(t, s, 8)
+
+		n, err := c.Count()
+		require.NoError(t, err)
+		total += n
+	}
+	assert.EqualValues(t, 1<<22+1000, total)
+}
+
+func TestSplitByEncodedSizeTooSmall(t *testing.T) {
+	bf := NewFromSet([]uint64{1 << 50})
+	_, err := bf.SplitByEncodedSize(2)
+	assert.Error(t, err)
+
+	_, err = bf.SplitByEncodedSize(0)
+	assert.Error(t, err)
+}
+
+func TestSplitByCount(t *testing.T) {
+	bf := NewFromSet(getRandIndexSet(10000))
+	bf.Set(10000000)
+	bf.Set(10000001)
+
+	for _, n := range []uint64{1, 7, 1000, 10002, 20000} {
+		chunks, err := bf.SplitByCount(n)
+		require.NoError(t, err)
+		checkSplit(t, bf, chunks)
+
+		for i, c := range chunks {
+			count, err := c.Count()
+			require.NoError(t, err)
+			if i < len(chunks)-1 {
+				assert.Equal(t, n, count)
+			} else {
+				assert.LessOrEqual(t, count, n)
+			}
+		}
+	}
+
+	_, err := bf.SplitByCount(0)
+	assert.Error(t, err)
+
+	chunks, err := New().SplitByCount(10)
+	require.NoError(t, err)
+	assert.Empty(t, chunks)
+}
@@ -0,0 +1,112 @@
+package bitfield
+
+import (
+	"encoding/binary"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+)
+
+// Stats describes the runs of a bitfield and their RLE+ encoding.
+type Stats struct {
+	// EncodedSize is the size in bytes of the RLE+ encoding.
+	EncodedSize int
+
+	// Runs is the number of encoded runs, that is ZeroRuns + OneRuns. A
+	// trailing run of zeros isn't encoded or counted.
+	Runs     uint64
+	ZeroRuns uint64
+	OneRuns  uint64
+
+	// Count is the number of set bits.
+	Count uint64
+	// First and Last are the first and last set bits, or zero if no bits
+	// are set.
+	First, Last uint64
+
+	// LongestRun is the length of the longest run of set bits, and
+	// LongestGap the length of the longest run of unset bits before the last
+	// set bit.
+	LongestRun uint64
+	LongestGap uint64
+
+	// Histogram counts the runs by how they're encoded.
+	Histogram RunHistogram
+}
+
+// RunHistogram counts runs by their RLE+ encoding.
+type RunHistogram struct {
+	// Single is the number of runs of length 1, encoded in 1 bit.
+	Single uint64
+	// Short is the number of runs of length 2 to 15, encoded in 6 bits.
+	Short uint64
+	// Varint is the number of longer runs, encoded in 2 bits plus a varint,
+	// and VarintBytes is the total size of their varints.
+	Varint      uint64
+	VarintBytes uint64
+}
+
+// Stats returns statistics about the bitfield's runs and encoding.
+//
+// This operation's runtime is O(number of runs).
+func (bf BitField) Stats() (Stats, error) {
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var (
+		st     Stats
+		sc     rlepluslazy.SizeCounter
+		pos    uint64
+		varBuf [binary.MaxVarintLen64]byte
+	)
+	for iter.HasNext() {
+		r, err := iter.NextRun()
+		if err != nil {
+			return Stats{}, err
+		}
+		if err := sc.Add(r); err != nil {
+			return Stats{}, err
+		}
+		if !r.Val {
+			if !iter.HasNext() {
+				break
+			}
+			st.ZeroRuns++
+			if r.Len > st.LongestGap {
+				st.LongestGap = r.Len
+			}
+		} else {
+			if st.OneRuns == 0 {
+				st.First = pos
+			}
+			st.OneRuns++
+			st.Count += r.Len
+			st.Last = pos + r.Len - 1
+			if r.Len > st.LongestRun {
+				st.LongestRun = r.Len
+			}
+		}
+		pos += r.Len
+
+		switch {
+		case r.Len == 1:
+			st.Histogram.Single++
+		case r.Len < 16:
+			st.Histogram.Short++
+		default:
+			st.Histogram.Varint++
+			st.Histogram.VarintBytes += uint64(binary.PutUvarint(varBuf[:], r.Len))
+		}
+	}
+	st.Runs = st.ZeroRuns + st.OneRuns
+
+	if len(bf.set) == 0 && len(bf.unset) == 0 {
+		// Use the size of the existing encoding, which may be of another
+		// version.
+		st.EncodedSize = len(bf.rle.Bytes())
+	} else {
+		st.EncodedSize = sc.Size()
+	}
+	return st, nil
+}
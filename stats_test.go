@@ -0,0 +1,81 @@
+package bitfield
+
+import (
+	"testing"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	bf, err := NewFromIter(&rlepluslazy.RunSliceIterator{Runs: []rlepluslazy.Run{
+		{Val: false, Len: 3},
+		{Val: true, Len: 1},
+		{Val: false, Len: 200},
+		{Val: true, Len: 20},
+		{Val: false, Len: 1},
+		{Val: true, Len: 5},
+	}})
+	require.NoError(t, err)
+
+	st, err := bf.Stats()
+	require.NoError(t, err)
+	assert.Equal(t, Stats{
+		EncodedSize: len(bf.rle.Bytes()),
+		Runs:        6,
+		ZeroRuns:    3,
+		OneRuns:     3,
+		Count:       26,
+		First:       3,
+		Last:        229,
+		LongestRun:  20,
+		LongestGap:  200,
+		Histogram: RunHistogram{
+			Single:      2,
+			Short:       2,
+			Varint:      2,
+			VarintBytes: 3,
+		},
+	}, st)
+
+	// Modified bitfields are sized without encoding, and the trailing run of
+	// zeros isn't counted.
+	for b := uint64(225); b <= 229; b++ {
+		bf.Unset(b)
+	}
+	st, err = bf.Stats()
+	require.NoError(t, err)
+	size, err := bf.EncodedSize()
+	require.NoError(t, err)
+	assert.Equal(t, size, st.EncodedSize)
+	assert.EqualValues(t, 4, st.Runs)
+	assert.EqualValues(t, 223, st.Last)
+
+	st, err = New().Stats()
+	require.NoError(t, err)
+	assert.Equal(t, Stats{}, st)
+}
+
+func TestStatsRandom(t *testing.T) {
+	for i := int64(0); i < 20; i++ {
+		bf, err := NewFromIter(rlepluslazy.NewFromZipfDist(i, 1000))
+		require.NoError(t, err)
+
+		st, err := bf.Stats()
+		require.NoError(t, err)
+
+		count, err := bf.Count()
+		require.NoError(t, err)
+		assert.Equal(t, count, st.Count)
+
+		h := st.Histogram
+		assert.Equal(t, st.Runs, h.Single+h.Short+h.Varint)
+
+		// The encoding is the header, the codes of each run, and padding,
+		// minus trailing zero bytes.
+		bits := 3 + h.Single + 6*h.Short + 2*h.Varint + 8*h.VarintBytes
+		assert.LessOrEqual(t, uint64(st.EncodedSize), (bits+7)/8)
+	}
+}
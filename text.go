@@ -0,0 +1,199 @@
+package bitfield
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+
+	rlepluslazy "github.com/filecoin-project/go-bitfield/rle"
+)
+
+// String returns the set bits as a list of ranges, such as "0-2,8-9,12".
+func (bf BitField) String() string {
+	text, err := bf.MarshalText()
+	if err != nil {
+		return fmt.Sprintf("<invalid bitfield: %s>", err)
+	}
+	return string(text)
+}
+
+// MarshalText encodes the set bits as a comma-separated list of bits and
+// inclusive ranges, such as "0-2,8-9,12". An empty bitfield is encoded as an
+// empty string.
+func (bf BitField) MarshalText() ([]byte, error) {
+	iter, err := bf.RunIterator()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		buf []byte
+		pos uint64
+	)
+	for iter.HasNext() {
+		r, err := iter.NextRun()
+		if err != nil {
+			return nil, err
+		}
+		if r.Val {
+			if len(buf) > 0 {
+				buf = append(buf, ',')
+			}
+			buf = strconv.AppendUint(buf, pos, 10)
+			if r.Len > 1 {
+				buf = append(buf, '-')
+				buf = strconv.AppendUint(buf, pos+r.Len-1, 10)
+			}
+		}
+		pos += r.Len
+	}
+	return buf, nil
+}
+
+// UnmarshalText decodes a list of ranges, as accepted by ParseBitField.
+func (bf *BitField) UnmarshalText(text []byte) error {
+	parsed, err := ParseBitField(string(text))
+	if err != nil {
+		return err
+	}
+	*bf = parsed
+	return nil
+}
+
+// ParseBitField parses a comma-separated list of bits and inclusive ranges,
+// such as "0-2, 8-9, 12", as produced by String. Ranges must be in increasing
+// order and must not overlap. Whitespace around bits is ignored.
+func ParseBitField(s string) (BitField, error) {
+	return parseBitField(s, 0, false)
+}
+
+// ParseBitFieldWithBound is like ParseBitField, but also accepts an open range
+// "N-" for the bits from N up to, but not including, bound. All bits must be
+// below bound.
+func ParseBitFieldWithBound(s string, bound uint64) (BitField, error) {
+	return parseBitField(s, bound, true)
+}
+
+func parseBitField(s string, bound uint64, bounded bool) (BitField, error) {
+	var rb rangeBuilder
+	if strings.TrimSpace(s) == "" {
+		return rb.bitField()
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+
+		var (
+			first, last uint64
+			err         error
+		)
+		if i := strings.IndexByte(item, '-'); i < 0 {
+			first, err = parseBit(item)
+			last = first
+		} else {
+			first, err = parseBit(item[:i])
+			if err != nil {
+				return BitField{}, err
+			}
+			if lastText := strings.TrimSpace(item[i+1:]); lastText != "" {
+				last, err = parseBit(lastText)
+			} else if !bounded {
+				return BitField{}, xerrors.Errorf("open range %q requires a bound", item)
+			} else if bound == 0 {
+				return BitField{}, xerrors.Errorf("open range %q is empty", item)
+			} else {
+				last = bound - 1
+			}
+		}
+		if err != nil {
+			return BitField{}, err
+		}
+
+		if bounded && last >= bound {
+			return BitField{}, xerrors.Errorf("range %q exceeds the bound %d", item, bound)
+		}
+		if err := rb.add(first, last); err != nil {
+			return BitField{}, xerrors.Errorf("range %q: %w", item, err)
+		}
+	}
+
+	return rb.bitField()
+}
+
+// rangeBuilder builds a bitfield from increasing, non-overlapping ranges of set
+// bits.
+type rangeBuilder struct {
+	runs []rlepluslazy.Run
+	end  uint64 // end of the last range
+}
+
+// add adds the inclusive range [first, last].
+func (rb *rangeBuilder) add(first, last uint64) error {
+	if last < first {
+		return xerrors.New("end is before start")
+	}
+	if last == math.MaxUint64 {
+		return xerrors.Errorf("bit %d is out of range", last)
+	}
+	if len(rb.runs) > 0 && first < rb.end {
+		return xerrors.New("overlaps or precedes the previous range")
+	}
+
+	if len(rb.runs) > 0 && first == rb.end {
+		// Adjacent to the last range.
+		rb.runs[len(rb.runs)-1].Len += last - first + 1
+	} else {
+		if first > rb.end {
+			rb.runs = append(rb.runs, rlepluslazy.Run{Val: false, Len: first - rb.end})
+		}
+		rb.runs = append(rb.runs, rlepluslazy.Run{Val: true, Len: last - first + 1})
+	}
+	rb.end = last + 1
+	return nil
+}
+
+func (rb *rangeBuilder) bitField() (BitField, error) {
+	return NewFromIter(&rlepluslazy.RunSliceIterator{Runs: rb.runs})
+}
+
+// limitedBitField is like bitField, but fails if the encoded bitfield would
+// be larger than MaxEncodedSize.
+func (rb *rangeBuilder) limitedBitField() (BitField, error) {
+	size, err := rlepluslazy.EncodedSize(&rlepluslazy.RunSliceIterator{Runs: rb.runs})
+	if err != nil {
+		return BitField{}, err
+	}
+	if err := checkEncodedSize(uint64(size)); err != nil {
+		return BitField{}, err
+	}
+	return rb.bitField()
+}
+
+func parseBit(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, xerrors.New("missing bit in range list")
+	}
+	bit, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, xerrors.Errorf("invalid bit %q: %w", s, err)
+	}
+	if bit == math.MaxUint64 {
+		return 0, xerrors.Errorf("bit %d is out of range", bit)
+	}
+	return bit, nil
+}
+
+// Flag is a flag.Value holding a BitField, set with the syntax accepted by
+// ParseBitField.
+type Flag struct {
+	BitField
+}
+
+// Set parses s as a list of ranges.
+func (f *Flag) Set(s string) error {
+	return f.BitField.UnmarshalText([]byte(s))
+}
@@ -0,0 +1,112 @@
+package bitfield
+
+import (
+	"encoding"
+	"flag"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ fmt.Stringer             = BitField{}
+	_ encoding.TextMarshaler   = BitField{}
+	_ encoding.TextUnmarshaler = (*BitField)(nil)
+	_ flag.Value               = (*Flag)(nil)
+)
+
+func TestBitfieldString(t *testing.T) {
+	for _, tc := range []struct {
+		bits []uint64
+		text string
+	}{
+		{nil, ""},
+		{[]uint64{0}, "0"},
+		{[]uint64{0, 1, 2, 8, 9}, "0-2,8-9"},
+		{[]uint64{0, 1, 2, 3, 4, 5, 8, 10, 11, 12}, "0-5,8,10-12"},
+		{[]uint64{math.MaxUint64 - 1}, "18446744073709551614"},
+	} {
+		bf := NewFromSet(tc.bits)
+		assert.Equal(t, tc.text, bf.String())
+		assert.Equal(t, tc.text, fmt.Sprint(bf))
+
+		parsed, err := ParseBitField(tc.text)
+		require.NoError(t, err)
+		bits, err := parsed.All(100)
+		require.NoError(t, err)
+		if len(tc.bits) == 0 {
+			assert.Empty(t, bits)
+		} else {
+			assert.Equal(t, tc.bits, bits)
+		}
+	}
+}
+
+func TestParseBitField(t *testing.T) {
+	bf, err := ParseBitField(" 0 - 2 , 3,8-9 ,\t12 ")
+	require.NoError(t, err)
+	assert.Equal(t, "0-3,8-9,12", bf.String())
+
+	for _, s := range []string{
+		"1,0",
+		"0-5,3",
+		"0-5,5-6",
+		"5-2",
+		"-3",
+		"3-",
+		"a",
+		"1,,2",
+		"1,",
+		"18446744073709551615",
+		"18446744073709551616",
+	} {
+		_, err := ParseBitField(s)
+		assert.Error(t, err, "%q", s)
+	}
+}
+
+func TestParseBitFieldWithBound(t *testing.T) {
+	bf, err := ParseBitFieldWithBound("0-2,8-", 12)
+	require.NoError(t, err)
+	assert.Equal(t, "0-2,8-11", bf.String())
+
+	bf, err = ParseBitFieldWithBound("0-", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "0", bf.String())
+
+	_, err = ParseBitFieldWithBound("0-2,12", 12)
+	assert.Error(t, err)
+	_, err = ParseBitFieldWithBound("12-", 12)
+	assert.Error(t, err)
+	_, err = ParseBitFieldWithBound("0-", 0)
+	assert.Error(t, err)
+}
+
+func TestBitfieldTextRoundTrip(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		bf := NewFromSet(getRandIndexSetSeed(1000, int64(i)))
+		text, err := bf.MarshalText()
+		require.NoError(t, err)
+
+		var out BitField
+		require.NoError(t, out.UnmarshalText(text))
+		assert.Equal(t, marshalBytes(t, bf), marshalBytes(t, out))
+	}
+}
+
+func TestBitfieldFlag(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var sectors Flag
+	fs.Var(&sectors, "sectors", "sectors to check")
+
+	require.NoError(t, fs.Parse([]string{"-sectors", "1-3,7"}))
+	count, err := sectors.Count()
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, count)
+	assert.Equal(t, "1-3,7", sectors.String())
+
+	assert.Error(t, fs.Parse([]string{"-sectors", "3,1"}))
+}